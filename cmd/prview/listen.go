@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// unixPrefix marks a --listen value as a Unix domain socket path.
+const unixPrefix = "unix:"
+
+// listenSpec is a parsed listen address.
+type listenSpec struct {
+	network string // "tcp" or "unix"
+	address string // host:port for tcp, socket path for unix
+}
+
+// parseListen resolves the --listen, --host and --port flags into a listen
+// spec. A non-empty listen overrides host and port; it accepts "host:port",
+// "[ipv6]:port", a bare host (port taken from port), a bare port (host taken
+// from host), or "unix:/path.sock".
+func parseListen(listen, host string, port int) (listenSpec, error) {
+	if listen == "" {
+		return listenSpec{network: "tcp", address: net.JoinHostPort(trimBrackets(host), strconv.Itoa(port))}, nil
+	}
+	if strings.HasPrefix(listen, unixPrefix) {
+		path := strings.TrimPrefix(listen, unixPrefix)
+		if path == "" {
+			return listenSpec{}, fmt.Errorf("empty unix socket path in %q", listen)
+		}
+		return listenSpec{network: "unix", address: path}, nil
+	}
+	if strings.Trim(listen, "0123456789") == "" {
+		// All digits: a port, which would otherwise be looked up as a host name.
+		if _, err := strconv.ParseUint(listen, 10, 16); err != nil {
+			return listenSpec{}, fmt.Errorf("invalid port in %q", listen)
+		}
+		return listenSpec{network: "tcp", address: net.JoinHostPort(trimBrackets(host), listen)}, nil
+	}
+	h, p, err := net.SplitHostPort(listen)
+	if err != nil {
+		// No port given: treat the whole value as a host (IPv6 may be bracketed or bare).
+		return listenSpec{network: "tcp", address: net.JoinHostPort(trimBrackets(listen), strconv.Itoa(port))}, nil
+	}
+	if _, err := strconv.ParseUint(p, 10, 16); err != nil {
+		return listenSpec{}, fmt.Errorf("invalid port in %q", listen)
+	}
+	return listenSpec{network: "tcp", address: net.JoinHostPort(h, p)}, nil
+}
+
+func trimBrackets(host string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// String returns the address in the form accepted by --listen.
+func (l listenSpec) String() string {
+	if l.network == "unix" {
+		return unixPrefix + l.address
+	}
+	return l.address
+}
+
+// listen opens the listener. A stale Unix socket left behind by a previous
+// run is removed first; any other existing file is left alone.
+func (l listenSpec) listen() (net.Listener, error) {
+	if l.network == "unix" {
+		if info, err := os.Lstat(l.address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(l.address)
+		}
+	}
+	return net.Listen(l.network, l.address)
+}
+
+// isLoopback reports whether addr (a host:port from a TCP listener) only
+// accepts local connections.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// browserURL returns the URL to open for a TCP listen address. Wildcard
+// addresses, including an empty host, are reachable through localhost.
+func browserURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
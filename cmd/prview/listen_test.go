@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestParseListen(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   listenSpec
+		err    bool
+	}{
+		{"", listenSpec{"tcp", "127.0.0.1:8888"}, false},
+		{"0.0.0.0:9000", listenSpec{"tcp", "0.0.0.0:9000"}, false},
+		{"localhost:9000", listenSpec{"tcp", "localhost:9000"}, false},
+		{"[::1]:9000", listenSpec{"tcp", "[::1]:9000"}, false},
+		{"[::1]", listenSpec{"tcp", "[::1]:8888"}, false},
+		{"::1", listenSpec{"tcp", "[::1]:8888"}, false},
+		{"example.test", listenSpec{"tcp", "example.test:8888"}, false},
+		{":9000", listenSpec{"tcp", ":9000"}, false},
+		{"9000", listenSpec{"tcp", "127.0.0.1:9000"}, false},
+		{"99999", listenSpec{}, true},
+		{"host:port", listenSpec{}, true},
+		{"unix:/tmp/prview.sock", listenSpec{"unix", "/tmp/prview.sock"}, false},
+		{"unix:", listenSpec{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseListen(tt.listen, "127.0.0.1", 8888)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseListen(%q) = %+v, %v; want %+v, error %v", tt.listen, got, err, tt.want, tt.err)
+		}
+	}
+
+	// Without --listen, --host may be a bracketed or bare IPv6 address.
+	for _, host := range []string{"::1", "[::1]"} {
+		if got, _ := parseListen("", host, 8888); got.address != "[::1]:8888" {
+			t.Errorf("host %q: address = %q", host, got.address)
+		}
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:8888", true},
+		{"127.1.2.3:8888", true},
+		{"localhost:8888", true},
+		{"[::1]:8888", true},
+		{"0.0.0.0:8888", false},
+		{"[::]:8888", false},
+		{":8888", false},
+		{"192.168.1.2:8888", false},
+		{"example.test:8888", false},
+		{"not an address", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopback(tt.addr); got != tt.want {
+			t.Errorf("isLoopback(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestBrowserURL(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"127.0.0.1:8888", "http://127.0.0.1:8888"},
+		{"localhost:8888", "http://localhost:8888"},
+		{"[::1]:8888", "http://[::1]:8888"},
+		{"0.0.0.0:8888", "http://localhost:8888"},
+		{"[::]:8888", "http://localhost:8888"},
+		{":9000", "http://localhost:9000"},
+		{"192.168.1.2:8888", "http://192.168.1.2:8888"},
+	}
+	for _, tt := range tests {
+		if got := browserURL(tt.addr); got != tt.want {
+			t.Errorf("browserURL(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
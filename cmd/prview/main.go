@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -18,7 +21,10 @@ import (
 	"github.com/flatcoke/prview/internal/server"
 )
 
-const defaultPort = 8888
+const (
+	defaultPort = 8888
+	defaultHost = "127.0.0.1"
+)
 
 var (
 	version = "dev"
@@ -27,8 +33,16 @@ var (
 
 func main() {
 	port := flag.Int("port", defaultPort, "Port to listen on")
+	host := flag.String("host", defaultHost, "Host/interface to listen on")
+	listen := flag.String("listen", "", "Listen address: host:port, [ipv6]:port or unix:/path.sock (overrides --host/--port)")
 	staged := flag.Bool("staged", false, "Show staged changes")
 	all := flag.Bool("all", false, "Show staged + unstaged changes")
+	algorithm := flag.String("diff-algorithm", "", "Diff algorithm: myers, minimal, patience or histogram")
+	ignoreAllSpace := flag.Bool("ignore-all-space", false, "Ignore whitespace when comparing lines (git diff -w)")
+	ignoreSpaceChange := flag.Bool("ignore-space-change", false, "Ignore changes in amount of whitespace (git diff -b)")
+	ignoreBlankLines := flag.Bool("ignore-blank-lines", false, "Ignore changes whose lines are all blank")
+	unified := flag.Int("unified", 3, "Lines of context around changes")
+	readOnly := flag.Bool("read-only", false, "Disable clearing changes and deleting branches/worktrees")
 	noOpen := flag.Bool("no-open", false, "Don't open browser automatically")
 	showVersion := flag.Bool("version", false, "Print version and exit")
 	flag.Parse()
@@ -51,6 +65,22 @@ func main() {
 		}
 	}
 
+	diffOpts := git.DiffOptions{
+		Algorithm:        *algorithm,
+		IgnoreBlankLines: *ignoreBlankLines,
+		Context:          unified,
+	}
+	switch {
+	case *ignoreAllSpace:
+		diffOpts.Whitespace = git.WhitespaceAll
+	case *ignoreSpaceChange:
+		diffOpts.Whitespace = git.WhitespaceChange
+	}
+	if err := diffOpts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "prview: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Detect mode: single repo vs workspace.
 	isWorkspace := false
 	if !git.IsGitRepo(workDir) {
@@ -65,18 +95,45 @@ func main() {
 		}
 	}
 
+	spec, err := parseListen(*listen, *host, *port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "prview: %v\n", err)
+		os.Exit(1)
+	}
+	ln, err := spec.listen()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "prview: listen %s: %v\n", spec, err)
+		os.Exit(1)
+	}
+	// Report the bound port (resolves port 0), keeping the host as given so
+	// a --host hostname stays valid for Host header checks.
+	if spec.network == "tcp" {
+		host, _, _ := net.SplitHostPort(spec.address)
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		spec.address = net.JoinHostPort(host, port)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "prview: generate token: %v\n", err)
+		os.Exit(1)
+	}
+
 	cfg := server.Config{
 		Port:      *port,
+		Addr:      spec.String(),
+		Token:     token,
+		ReadOnly:  *readOnly,
 		Staged:    *staged,
 		All:       *all,
 		RefArgs:   args,
+		Diff:      diffOpts,
 		WorkDir:   workDir,
 		Workspace: isWorkspace,
 	}
 
 	handler := server.New(cfg)
-	addr := fmt.Sprintf(":%d", cfg.Port)
-	srv := &http.Server{Addr: addr, Handler: handler}
+	srv := &http.Server{Handler: handler}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -88,20 +145,43 @@ func main() {
 		srv.Shutdown(shutdownCtx)
 	}()
 
-	url := fmt.Sprintf("http://localhost:%d", cfg.Port)
-	fmt.Printf("prview listening on %s\n", url)
-
-	if !*noOpen {
-		openBrowser(url)
+	if cfg.ReadOnly {
+		fmt.Println("prview: read-only mode — clear and delete actions are disabled")
+	}
+	if spec.network == "unix" {
+		fmt.Printf("prview listening on %s (token %s)\n", spec, token)
+	} else {
+		url := browserURL(spec.address) + "/?token=" + token
+		fmt.Printf("prview listening on %s\n", url)
+		if !isLoopback(spec.address) {
+			fmt.Fprintf(os.Stderr, "\n"+
+				"  WARNING: prview is listening on %s, which is reachable from other machines.\n"+
+				"  Anyone who can connect can read your diffs and discard changes, delete\n"+
+				"  branches and remove worktrees. Use --host 127.0.0.1 unless you mean it.\n\n",
+				spec.address)
+		}
+		if !*noOpen {
+			openBrowser(url)
+		}
 	}
 
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+	if err := srv.Serve(ln); err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
 
 	fmt.Println("\nprview stopped.")
 }
 
+// newToken returns a random hex token that authorises mutating requests for
+// this launch only.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // openBrowser launches the system default browser pointing at url.
 func openBrowser(url string) {
 	var cmd *exec.Cmd
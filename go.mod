@@ -5,6 +5,7 @@ go 1.24
 require (
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/gorilla/websocket v1.5.3
+	golang.org/x/image v0.25.0
 )
 
 require golang.org/x/sys v0.13.0 // indirect
@@ -0,0 +1,36 @@
+package git
+
+import "strings"
+
+// checkAttrs returns the values of attrs for paths (relative to the
+// repository root) as set by .gitattributes files: "set", "unset", a value,
+// or absent when unspecified. If repoDir is empty, git runs in the current
+// working directory.
+func checkAttrs(repoDir string, attrs, paths []string) (map[string]map[string]string, error) {
+	result := map[string]map[string]string{}
+	if len(paths) == 0 {
+		return result, nil
+	}
+	top, err := runGit(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"check-attr", "-z", "--stdin"}, attrs...)
+	out, err := gitCmd{dir: top, stdin: strings.Join(paths, "\x00") + "\x00", args: args}.run()
+	if err != nil {
+		return nil, err
+	}
+	// Output is path, attribute and value, each NUL-terminated.
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		path, attr, value := fields[i], fields[i+1], fields[i+2]
+		if value == "unspecified" {
+			continue
+		}
+		if result[path] == nil {
+			result[path] = map[string]string{}
+		}
+		result[path][attr] = value
+	}
+	return result, nil
+}
@@ -0,0 +1,25 @@
+package git
+
+// maxMeasuredBinaries caps the binary files MeasureBinaries sizes per diff,
+// as the working tree side of each is hashed to find it.
+const maxMeasuredBinaries = 200
+
+// MeasureBinaries sets OldSize and NewSize on result's binary files, whose
+// diffs say nothing else about their content. It is best effort: sides that
+// are missing or cannot be read keep a size of zero.
+func MeasureBinaries(repoDir string, result *DiffResult) {
+	measured := 0
+	for i := range result.Files {
+		f := &result.Files[i]
+		if !f.IsBinary || measured == maxMeasuredBinaries {
+			continue
+		}
+		measured++
+		if f.OldName != "/dev/null" && f.OldBlob != "" {
+			f.OldSize, _ = BlobSize(repoDir, f.OldName, f.OldBlob)
+		}
+		if f.NewName != "/dev/null" && f.NewBlob != "" {
+			f.NewSize, _ = BlobSize(repoDir, f.NewName, f.NewBlob)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMeasureBinaries(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, "logo.bin"), "a\x00b")
+	mustGit(t, dir, "add", "logo.bin")
+	mustGit(t, dir, "commit", "-q", "-m", "logo")
+	mustWrite(t, filepath.Join(dir, "logo.bin"), "a\x00"+strings.Repeat("b", 99))
+	mustWrite(t, filepath.Join(dir, "new.bin"), "\x00\x00")
+
+	result, err := DiffInRepo(dir, DiffOptions{}, nil)
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	if err := AddUntracked(dir, result); err != nil {
+		t.Fatalf("AddUntracked: %v", err)
+	}
+	MeasureBinaries(dir, result)
+	files := make(map[string]FileDiff)
+	for _, f := range result.Files {
+		files[f.NewName] = f
+	}
+	if f := files["logo.bin"]; f.OldSize != 3 || f.NewSize != 101 {
+		t.Errorf("logo.bin: got %d → %d bytes", f.OldSize, f.NewSize)
+	}
+	if f := files["new.bin"]; f.OldSize != 0 || f.NewSize != 2 {
+		t.Errorf("new.bin: got %d → %d bytes", f.OldSize, f.NewSize)
+	}
+}
@@ -0,0 +1,189 @@
+package git
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// checkpointRefPrefix is the ref namespace holding one review checkpoint per
+// branch. As with snapshots, the ref keeps the recorded tree from being
+// garbage collected.
+const checkpointRefPrefix = "refs/prview/checkpoints/"
+
+// ErrNoCheckpoint is returned when a branch has no review checkpoint yet.
+var ErrNoCheckpoint = errors.New("no review checkpoint recorded for this branch")
+
+// Checkpoint records the full state of a working tree — committed, staged,
+// unstaged and untracked (non-ignored) files alike — at the end of a review
+// pass, so that the next pass can look only at what changed since.
+type Checkpoint struct {
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"` // wraps Tree, with HEAD at the time as parent
+	Tree   string `json:"tree"`
+	Time   int64  `json:"time"` // unix timestamp
+}
+
+// CheckpointRef returns the ref branch's checkpoint is stored at.
+func CheckpointRef(branch string) string {
+	return checkpointRefPrefix + branchKey(branch)
+}
+
+// worktreeTrees remembers the tree WorktreeTree last wrote for each
+// repository, keyed by top-level directory, with the state it was written
+// from, so that refreshing an unchanged working tree writes no objects.
+var (
+	worktreeTreesMu sync.Mutex
+	worktreeTrees   = map[string]cachedTree{}
+)
+
+type cachedTree struct {
+	state string
+	tree  string
+}
+
+// WorktreeTree writes the current contents of repoDir's working tree,
+// including untracked non-ignored files, as a tree object and returns its ID.
+// It stages into a scratch index; the real index is left untouched. While the
+// index and the changed files are as they were, the last tree is reused.
+func WorktreeTree(repoDir string) (string, error) {
+	top, err := runGit(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	state, err := worktreeState(top)
+	if err != nil {
+		return "", err
+	}
+	worktreeTreesMu.Lock()
+	cached, ok := worktreeTrees[top]
+	worktreeTreesMu.Unlock()
+	if ok && cached.state == state {
+		// gc may have pruned it, as nothing refers to it.
+		if _, err := runGit(top, "cat-file", "-e", cached.tree); err == nil {
+			return cached.tree, nil
+		}
+	}
+	tree, err := writeWorktreeTree(top)
+	if err != nil {
+		return "", err
+	}
+	worktreeTreesMu.Lock()
+	worktreeTrees[top] = cachedTree{state: state, tree: tree}
+	worktreeTreesMu.Unlock()
+	return tree, nil
+}
+
+// worktreeState summarises what WorktreeTree's result depends on: the index
+// file's size and mtime, and the size and mtime of every file git status
+// reports as changed or untracked. Files status does not list match the
+// index. It reads without taking the index lock or refreshing the index.
+func worktreeState(top string) (string, error) {
+	indexPath, err := runGit(top, "rev-parse", "--git-path", "index")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(indexPath) {
+		indexPath = filepath.Join(top, indexPath)
+	}
+	// Not runGit: trimming would cut the leading space of the first entry.
+	out, err := gitCmd{dir: top, args: []string{"--no-optional-locks", "status", "--porcelain", "-z", "--untracked-files=all", "--no-renames"}}.run()
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00", statKey(indexPath))
+	for _, entry := range strings.Split(out, "\x00") {
+		if len(entry) < 4 {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", entry, statKey(filepath.Join(top, entry[3:])))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// statKey describes path's size, mtime and mode, or its absence.
+func statKey(path string) string {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d %d %o", fi.Size(), fi.ModTime().UnixNano(), fi.Mode())
+}
+
+// writeWorktreeTree does the work of WorktreeTree for the top-level
+// directory top.
+func writeWorktreeTree(top string) (string, error) {
+	tmpDir, err := os.MkdirTemp("", "prview-checkpoint-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	index := filepath.Join(tmpDir, "index")
+	if err := copyIndex(top, index); err != nil {
+		return "", err
+	}
+	env := []string{"GIT_INDEX_FILE=" + index}
+	if _, err := (gitCmd{dir: top, env: env, args: []string{"add", "-A"}}).run(); err != nil {
+		return "", err
+	}
+	out, err := gitCmd{dir: top, env: env, args: []string{"write-tree"}}.run()
+	return strings.TrimSpace(out), err
+}
+
+// SaveCheckpoint records the current working tree as branch's checkpoint,
+// replacing any earlier one.
+func SaveCheckpoint(repoDir, branch string) (*Checkpoint, error) {
+	tree, err := WorktreeTree(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"commit-tree", tree, "-m", "prview review checkpoint on " + branchKey(branch)}
+	if head, err := runGit(repoDir, "rev-parse", "--verify", "-q", "HEAD"); err == nil {
+		args = append(args, "-p", head)
+	}
+	out, err := gitCmd{dir: repoDir, env: snapshotIdent, args: args}.run()
+	if err != nil {
+		return nil, err
+	}
+	commit := strings.TrimSpace(out)
+	ref := CheckpointRef(branch)
+	if _, err := runGit(repoDir, "update-ref", ref, commit); err != nil {
+		return nil, err
+	}
+	return LoadCheckpoint(repoDir, branch)
+}
+
+// LoadCheckpoint returns branch's checkpoint, or ErrNoCheckpoint.
+func LoadCheckpoint(repoDir, branch string) (*Checkpoint, error) {
+	ref := CheckpointRef(branch)
+	out, err := runGit(repoDir, "log", "-1", "--format=%H%x00%T%x00%ct", ref, "--")
+	if err != nil {
+		if _, verr := runGit(repoDir, "rev-parse", "--verify", "-q", ref); verr != nil {
+			return nil, ErrNoCheckpoint
+		}
+		return nil, err
+	}
+	fields := strings.Split(out, "\x00")
+	if len(fields) != 3 {
+		return nil, ErrNoCheckpoint
+	}
+	ts, _ := strconv.ParseInt(fields[2], 10, 64)
+	return &Checkpoint{Ref: ref, Commit: fields[0], Tree: fields[1], Time: ts}, nil
+}
+
+// DeleteCheckpoint removes branch's checkpoint.
+func DeleteCheckpoint(repoDir, branch string) error {
+	if _, err := LoadCheckpoint(repoDir, branch); err != nil {
+		return err
+	}
+	_, err := runGit(repoDir, "update-ref", "-d", CheckpointRef(branch))
+	return err
+}
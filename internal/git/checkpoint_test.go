@@ -0,0 +1,80 @@
+package git
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointDiff(t *testing.T) {
+	dir := newTestRepo(t)
+	if _, err := LoadCheckpoint(dir, "main"); !errors.Is(err, ErrNoCheckpoint) {
+		t.Fatalf("expected ErrNoCheckpoint, got %v", err)
+	}
+
+	// Reviewed state: an unstaged edit and an untracked file.
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "two\n")
+	mustWrite(t, filepath.Join(dir, "reviewed.txt"), "seen\n")
+	cp, err := SaveCheckpoint(dir, "main")
+	if err != nil {
+		t.Fatalf("SaveCheckpoint: %v", err)
+	}
+	if cp.Ref != "refs/prview/checkpoints/main" || cp.Tree == "" {
+		t.Errorf("unexpected checkpoint %+v", cp)
+	}
+	if status := mustGit(t, dir, "status", "--porcelain"); status != " M tracked.txt\n?? reviewed.txt\n" {
+		t.Errorf("checkpoint touched the index or worktree:\n%s", status)
+	}
+
+	// Follow-up work: one new untracked file, one more commit.
+	mustWrite(t, filepath.Join(dir, "later.txt"), "new\n")
+	mustGit(t, dir, "commit", "-q", "-am", "commit the edit")
+
+	tree, err := WorktreeTree(dir)
+	if err != nil {
+		t.Fatalf("WorktreeTree: %v", err)
+	}
+	result, err := DiffInRepo(dir, DiffOptions{}, []string{CheckpointRef("main"), tree})
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].NewName != "later.txt" {
+		t.Errorf("expected only later.txt since the checkpoint, got %+v", result.Files)
+	}
+
+	if err := DeleteCheckpoint(dir, "main"); err != nil {
+		t.Fatalf("DeleteCheckpoint: %v", err)
+	}
+	if _, err := LoadCheckpoint(dir, "main"); !errors.Is(err, ErrNoCheckpoint) {
+		t.Errorf("expected ErrNoCheckpoint after delete, got %v", err)
+	}
+}
+
+func TestWorktreeTreeReuse(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "two\n")
+	first, err := WorktreeTree(dir)
+	if err != nil {
+		t.Fatalf("WorktreeTree: %v", err)
+	}
+	again, err := WorktreeTree(dir)
+	if err != nil {
+		t.Fatalf("WorktreeTree: %v", err)
+	}
+	if again != first {
+		t.Errorf("unchanged worktree gave a new tree: %s, then %s", first, again)
+	}
+
+	// A further edit to an already modified file must not reuse the tree.
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "three\n")
+	edited, err := WorktreeTree(dir)
+	if err != nil {
+		t.Fatalf("WorktreeTree: %v", err)
+	}
+	if edited == first {
+		t.Fatal("edit to a modified file reused the earlier tree")
+	}
+	if got := mustGit(t, dir, "cat-file", "-p", edited+":tracked.txt"); got != "three\n" {
+		t.Errorf("tracked.txt in tree = %q, want %q", got, "three\n")
+	}
+}
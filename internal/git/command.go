@@ -0,0 +1,50 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// gitCmd describes a git invocation with optional extra environment and stdin.
+type gitCmd struct {
+	dir   string   // passed as -C; empty runs in the current directory
+	env   []string // appended to the process environment
+	stdin string
+	args  []string
+}
+
+// run executes the command and returns its stdout. On failure the error
+// carries git's trimmed stderr, which is usually the useful part.
+func (c gitCmd) run() (string, error) {
+	args := c.args
+	if c.dir != "" {
+		args = append([]string{"-C", c.dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	if len(c.env) > 0 {
+		cmd.Env = append(os.Environ(), c.env...)
+	}
+	if c.stdin != "" {
+		cmd.Stdin = strings.NewReader(c.stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return string(out), fmt.Errorf("git %s: %s", c.args[0], msg)
+	}
+	return string(out), nil
+}
+
+// runGit runs git in dir and returns its stdout with surrounding whitespace trimmed.
+func runGit(dir string, args ...string) (string, error) {
+	out, err := gitCmd{dir: dir, args: args}.run()
+	return strings.TrimSpace(out), err
+}
@@ -0,0 +1,344 @@
+package git
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Values for Comment.Side.
+const (
+	SideOld = "old" // the line as it was before the change (a "del" or context line)
+	SideNew = "new" // the line as it is after the change (an "add" or context line)
+)
+
+// ErrCommentNotFound is returned when a comment ID does not exist on the branch.
+var ErrCommentNotFound = errors.New("comment not found")
+
+// Comment is a local review note attached to one line of a diff.
+//
+// The anchor is Path, Side and Line plus the line's Content and a hash of it
+// together with its neighbours on the same side. When later edits shift the
+// diff, the comment is moved to the line whose hash (or, failing that,
+// content) matches nearest to where it was; if neither is found it is
+// reported Outdated at its last known position.
+type Comment struct {
+	ID       string `json:"id"`
+	Branch   string `json:"branch"`
+	Path     string `json:"path"`
+	Side     string `json:"side"`
+	Line     int    `json:"line"`
+	Content  string `json:"content"`
+	Hash     string `json:"hash"`
+	Body     string `json:"body"`
+	Created  int64  `json:"created"` // unix timestamp
+	Updated  int64  `json:"updated"` // unix timestamp
+	Outdated bool   `json:"outdated,omitempty"`
+}
+
+// commentsMu serialises read-modify-write cycles on comment files.
+var commentsMu sync.Mutex
+
+// commentsFile returns the file holding branch's comments. It lives in the
+// common git dir so that every worktree of a repository shares it.
+func commentsFile(repoDir, branch string) (string, error) {
+	common, err := runGit(repoDir, "rev-parse", "--path-format=absolute", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(common, "prview", "comments", url.PathEscape(branchKey(branch))+".json"), nil
+}
+
+// branchKey names the key per-branch state (comments, checkpoints) is stored
+// under; a detached HEAD shares one set.
+func branchKey(branch string) string {
+	if branch == "" {
+		return "HEAD"
+	}
+	return branch
+}
+
+func loadComments(file string) ([]Comment, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Comment{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var comments []Comment
+	if err := json.Unmarshal(data, &comments); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return comments, nil
+}
+
+// saveComments writes comments atomically via a temporary file and rename.
+func saveComments(file string, comments []Comment) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(comments, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// ListComments returns the comments stored for branch, oldest first.
+func ListComments(repoDir, branch string) ([]Comment, error) {
+	file, err := commentsFile(repoDir, branch)
+	if err != nil {
+		return nil, err
+	}
+	commentsMu.Lock()
+	defer commentsMu.Unlock()
+	return loadComments(file)
+}
+
+// AddComment stores a new comment on the given line of result, which must be
+// the diff the user was looking at. The anchor content and hash are taken from
+// that diff; it fails if the line is not part of it.
+func AddComment(repoDir, branch string, result *DiffResult, path, side string, line int, body string) (*Comment, error) {
+	if side != SideOld && side != SideNew {
+		return nil, fmt.Errorf("invalid side %q", side)
+	}
+	lines := sideLines(result, path, side)
+	i := lineIndex(lines, line)
+	if i < 0 {
+		return nil, fmt.Errorf("%s line %d (%s) is not in the diff", path, line, side)
+	}
+
+	file, err := commentsFile(repoDir, branch)
+	if err != nil {
+		return nil, err
+	}
+	commentsMu.Lock()
+	defer commentsMu.Unlock()
+	comments, err := loadComments(file)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	c := Comment{
+		ID:      strconv.FormatInt(now.UnixNano(), 10),
+		Branch:  branchKey(branch),
+		Path:    path,
+		Side:    side,
+		Line:    line,
+		Content: lines[i].content,
+		Hash:    lines[i].hash,
+		Body:    body,
+		Created: now.Unix(),
+		Updated: now.Unix(),
+	}
+	comments = append(comments, c)
+	return &c, saveComments(file, comments)
+}
+
+// UpdateComment replaces the body of a comment.
+func UpdateComment(repoDir, branch, id, body string) (*Comment, error) {
+	file, err := commentsFile(repoDir, branch)
+	if err != nil {
+		return nil, err
+	}
+	commentsMu.Lock()
+	defer commentsMu.Unlock()
+	comments, err := loadComments(file)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comments {
+		if comments[i].ID == id {
+			comments[i].Body = body
+			comments[i].Updated = time.Now().Unix()
+			c := comments[i]
+			return &c, saveComments(file, comments)
+		}
+	}
+	return nil, ErrCommentNotFound
+}
+
+// DeleteComment removes a comment.
+func DeleteComment(repoDir, branch, id string) error {
+	file, err := commentsFile(repoDir, branch)
+	if err != nil {
+		return err
+	}
+	commentsMu.Lock()
+	defer commentsMu.Unlock()
+	comments, err := loadComments(file)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		if comments[i].ID == id {
+			return saveComments(file, append(comments[:i], comments[i+1:]...))
+		}
+	}
+	return ErrCommentNotFound
+}
+
+// AnchorComments re-anchors branch's comments against result and returns
+// them, with Outdated set on those it cannot place. Nothing is stored: the
+// positions hold for result only, since views of other modes, commits or
+// options number lines differently. SaveAnchors persists moves.
+func AnchorComments(repoDir, branch string, result *DiffResult) ([]Comment, error) {
+	comments, err := ListComments(repoDir, branch)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comments {
+		c := &comments[i]
+		if line, ok, _ := reanchor(sideLines(result, c.Path, c.Side), *c); ok {
+			c.Line = line
+		} else {
+			c.Outdated = true
+		}
+	}
+	return comments, nil
+}
+
+// SaveAnchors re-anchors branch's comments against result and stores the
+// lines of those that moved, so later diffs search from there. result should
+// be one canonical diff (all changes against the base, default options)
+// whatever the user is viewing. Only moves found by anchor hash are stored:
+// a match on content alone, such as a lone "}", is too weak to keep.
+func SaveAnchors(repoDir, branch string, result *DiffResult) error {
+	file, err := commentsFile(repoDir, branch)
+	if err != nil {
+		return err
+	}
+	commentsMu.Lock()
+	defer commentsMu.Unlock()
+	comments, err := loadComments(file)
+	if err != nil {
+		return err
+	}
+	moved := false
+	for i := range comments {
+		c := &comments[i]
+		line, ok, byHash := reanchor(sideLines(result, c.Path, c.Side), *c)
+		if ok && byHash && line != c.Line {
+			c.Line = line
+			moved = true
+		}
+	}
+	if !moved {
+		return nil
+	}
+	return saveComments(file, comments)
+}
+
+// anchorLine is one line of one side of a file's diff.
+type anchorLine struct {
+	number  int
+	other   int // the line's number on the other side; 0 for added or deleted lines
+	content string
+	hash    string
+}
+
+// sideLines returns the lines of path's hunks present on side, with their
+// line numbers and anchor hashes. A file appearing more than once (layers
+// mode) contributes the lines of every entry.
+func sideLines(result *DiffResult, path, side string) []anchorLine {
+	var out []anchorLine
+	for _, f := range result.Files {
+		if filePath(f) != path && f.OldName != path {
+			continue
+		}
+		for _, h := range f.Hunks {
+			number, other, skip := h.NewStart, h.OldStart, "del"
+			if side == SideOld {
+				number, other, skip = h.OldStart, h.NewStart, "add"
+			}
+			var hunkLines []anchorLine
+			for _, l := range h.Lines {
+				if l.Type == skip {
+					other++
+					continue
+				}
+				al := anchorLine{number: number, content: l.Content}
+				if l.Type == "context" {
+					al.other = other
+					other++
+				}
+				hunkLines = append(hunkLines, al)
+				number++
+			}
+			for i := range hunkLines {
+				var prev, next string
+				if i > 0 {
+					prev = hunkLines[i-1].content
+				}
+				if i+1 < len(hunkLines) {
+					next = hunkLines[i+1].content
+				}
+				hunkLines[i].hash = anchorHash(prev, hunkLines[i].content, next)
+			}
+			out = append(out, hunkLines...)
+		}
+	}
+	return out
+}
+
+func anchorHash(prev, content, next string) string {
+	sum := sha1.Sum([]byte(prev + "\n" + content + "\n" + next))
+	return hex.EncodeToString(sum[:8])
+}
+
+func lineIndex(lines []anchorLine, number int) int {
+	for i, l := range lines {
+		if l.number == number {
+			return i
+		}
+	}
+	return -1
+}
+
+// reanchor finds c's line in lines: unchanged if its hash still matches,
+// otherwise the nearest line with the same hash, then the nearest with the
+// same content. ok is false if there is no match; byHash reports whether the
+// match is by hash rather than content alone.
+func reanchor(lines []anchorLine, c Comment) (line int, ok, byHash bool) {
+	if i := lineIndex(lines, c.Line); i >= 0 && lines[i].hash == c.Hash {
+		return c.Line, true, true
+	}
+	if n, ok := nearest(lines, c.Line, func(l anchorLine) bool { return l.hash == c.Hash }); ok {
+		return n, true, true
+	}
+	n, ok := nearest(lines, c.Line, func(l anchorLine) bool { return l.content == c.Content })
+	return n, ok, false
+}
+
+func nearest(lines []anchorLine, target int, match func(anchorLine) bool) (int, bool) {
+	best, found := 0, false
+	for _, l := range lines {
+		if !match(l) {
+			continue
+		}
+		if !found || abs(l.number-target) < abs(best-target) {
+			best, found = l.number, true
+		}
+	}
+	return best, found
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,100 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommentsCRUDAndReanchor(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(20, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "twenty lines")
+	mustWrite(t, file, numberedLines(20, map[int]string{10: "changed 10"}))
+
+	result := Parse(mustGit(t, dir, "diff"))
+	if _, err := AddComment(dir, "main", result, "tracked.txt", SideNew, 99, "nope"); err == nil {
+		t.Fatal("expected an error for a line outside the diff")
+	}
+	c, err := AddComment(dir, "main", result, "tracked.txt", SideNew, 10, "rename this")
+	if err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+	if c.Content != "changed 10" {
+		t.Errorf("anchor content = %q", c.Content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git", "prview", "comments", "main.json")); err != nil {
+		t.Errorf("comments not stored under .git/prview: %v", err)
+	}
+
+	// Three lines inserted above shift the commented line down.
+	mustWrite(t, file, numberedLines(20, map[int]string{1: "a\nb\nc\nline 1", 10: "changed 10"}))
+	anchored, err := AnchorComments(dir, "main", Parse(mustGit(t, dir, "diff")))
+	if err != nil {
+		t.Fatalf("AnchorComments: %v", err)
+	}
+	if len(anchored) != 1 || anchored[0].Line != 13 || anchored[0].Outdated {
+		t.Fatalf("expected comment moved to line 13, got %+v", anchored)
+	}
+	list, _ := ListComments(dir, "main")
+	if list[0].Line != 10 {
+		t.Errorf("anchoring stored the move: line %d", list[0].Line)
+	}
+	if err := SaveAnchors(dir, "main", Parse(mustGit(t, dir, "diff"))); err != nil {
+		t.Fatalf("SaveAnchors: %v", err)
+	}
+	if list, _ := ListComments(dir, "main"); list[0].Line != 13 {
+		t.Errorf("moved line not persisted: %d", list[0].Line)
+	}
+
+	// With the line gone the comment is outdated at its last position.
+	mustWrite(t, file, numberedLines(20, map[int]string{1: "a\nb\nc\nline 1"}))
+	anchored, _ = AnchorComments(dir, "main", Parse(mustGit(t, dir, "diff")))
+	if !anchored[0].Outdated || anchored[0].Line != 13 {
+		t.Errorf("expected outdated comment at line 13, got %+v", anchored[0])
+	}
+
+	if _, err := UpdateComment(dir, "main", c.ID, "add test"); err != nil {
+		t.Fatalf("UpdateComment: %v", err)
+	}
+	if list, _ := ListComments(dir, "main"); list[0].Body != "add test" {
+		t.Errorf("body not updated: %q", list[0].Body)
+	}
+	if list, _ := ListComments(dir, "other"); len(list) != 0 {
+		t.Errorf("comments leaked to another branch: %+v", list)
+	}
+	if err := DeleteComment(dir, "main", c.ID); err != nil {
+		t.Fatalf("DeleteComment: %v", err)
+	}
+	if err := DeleteComment(dir, "main", c.ID); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("expected ErrCommentNotFound, got %v", err)
+	}
+}
+
+func TestSaveAnchorsIgnoresContentMatches(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(20, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "twenty lines")
+	mustWrite(t, file, numberedLines(20, map[int]string{10: "}"}))
+	c, err := AddComment(dir, "main", Parse(mustGit(t, dir, "diff")), "tracked.txt", SideNew, 10, "brace")
+	if err != nil {
+		t.Fatalf("AddComment: %v", err)
+	}
+
+	// The brace line is gone; another "}" elsewhere matches on content only.
+	mustWrite(t, file, numberedLines(20, map[int]string{15: "}"}))
+	result := Parse(mustGit(t, dir, "diff"))
+	anchored, _ := AnchorComments(dir, "main", result)
+	if anchored[0].Line != 15 || anchored[0].Outdated {
+		t.Errorf("expected the comment shown at line 15, got %+v", anchored[0])
+	}
+	if err := SaveAnchors(dir, "main", result); err != nil {
+		t.Fatalf("SaveAnchors: %v", err)
+	}
+	if list, _ := ListComments(dir, "main"); list[0].Line != c.Line {
+		t.Errorf("content-only match stored: line %d", list[0].Line)
+	}
+}
@@ -0,0 +1,106 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Commit is one commit of a branch, with its diff stats.
+type Commit struct {
+	Hash      string `json:"hash"`
+	ShortHash string `json:"shortHash"`
+	Author    string `json:"author"`
+	Email     string `json:"email"`
+	Date      int64  `json:"date"` // author date, unix timestamp
+	Subject   string `json:"subject"`
+	Body      string `json:"body,omitempty"`
+	Files     int    `json:"files"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+// commitIDPattern matches full or abbreviated hexadecimal object IDs.
+var commitIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{4,64}$`)
+
+// IsCommitID reports whether s looks like an object ID, as opposed to a ref
+// name or an option. Values passed to git as revisions from requests must be
+// checked with it.
+func IsCommitID(s string) bool {
+	return commitIDPattern.MatchString(s)
+}
+
+// ErrInvalidRevision is returned for a revision that is empty, looks like an
+// option or does not name a commit.
+var ErrInvalidRevision = errors.New("invalid revision")
+
+// resolveCommit returns the full ID of the commit rev names. Revisions from
+// requests must go through it before reaching git, which would take one
+// starting with "-" as an option.
+func resolveCommit(repoDir, rev string) (string, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("%w %q", ErrInvalidRevision, rev)
+	}
+	hash, err := runGit(repoDir, "rev-parse", "--verify", "-q", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%w %q", ErrInvalidRevision, rev)
+	}
+	return hash, nil
+}
+
+// commitRecordSep starts each commit's record in ListCommits' log output.
+const commitRecordSep = "\x1e"
+
+// commitLogFormat is the git log --format parseCommits reads.
+const commitLogFormat = "--format=" + commitRecordSep + "%H%x00%h%x00%an%x00%ae%x00%at%x00%s%x00%b%x00"
+
+// ListCommits returns the commits on HEAD that are not on base, oldest first.
+func ListCommits(repoDir, base string) ([]Commit, error) {
+	baseHash, err := resolveCommit(repoDir, base)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runGit(repoDir, "log", "--reverse", "--numstat", "--no-color", commitLogFormat, baseHash+"..HEAD", "--")
+	if err != nil {
+		return nil, err
+	}
+	return parseCommits(out), nil
+}
+
+// parseCommits parses commitLogFormat output: per commit, the NUL-separated
+// header fields followed by any --numstat lines.
+func parseCommits(out string) []Commit {
+	commits := []Commit{}
+	for _, record := range strings.Split(out, commitRecordSep) {
+		fields := strings.SplitN(record, "\x00", 8)
+		if len(fields) != 8 {
+			continue
+		}
+		date, _ := strconv.ParseInt(fields[4], 10, 64)
+		c := Commit{
+			Hash:      fields[0],
+			ShortHash: fields[1],
+			Author:    fields[2],
+			Email:     fields[3],
+			Date:      date,
+			Subject:   fields[5],
+			Body:      strings.TrimSpace(fields[6]),
+		}
+		for _, line := range strings.Split(fields[7], "\n") {
+			parts := strings.SplitN(line, "\t", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			c.Files++
+			// Binary files show "-" for both counts.
+			add, _ := strconv.Atoi(parts[0])
+			del, _ := strconv.Atoi(parts[1])
+			c.Additions += add
+			c.Deletions += del
+		}
+		commits = append(commits, c)
+	}
+	return commits
+}
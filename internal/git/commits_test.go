@@ -0,0 +1,64 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListCommits(t *testing.T) {
+	dir := newTestRepo(t)
+	mustGit(t, dir, "checkout", "-q", "-b", "feature")
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "one\ntwo\n")
+	mustGit(t, dir, "commit", "-q", "-am", "add two", "-m", "Second paragraph.")
+	mustWrite(t, filepath.Join(dir, "a.txt"), "a\n")
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "two\n")
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "add a, drop one")
+
+	commits, err := ListCommits(dir, "main")
+	if err != nil {
+		t.Fatalf("ListCommits: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits, got %d", len(commits))
+	}
+	first, second := commits[0], commits[1]
+	if first.Subject != "add two" || first.Body != "Second paragraph." || first.Author != "test" {
+		t.Errorf("unexpected first commit %+v", first)
+	}
+	if first.Files != 1 || first.Additions != 1 || first.Deletions != 0 {
+		t.Errorf("first commit stats = %d files +%d -%d", first.Files, first.Additions, first.Deletions)
+	}
+	if second.Files != 2 || second.Additions != 1 || second.Deletions != 1 {
+		t.Errorf("second commit stats = %d files +%d -%d", second.Files, second.Additions, second.Deletions)
+	}
+	if !IsCommitID(second.ShortHash) || IsCommitID("--output=x") || IsCommitID("main") {
+		t.Error("IsCommitID misclassifies")
+	}
+
+	result, err := DiffInRepo(dir, DiffOptions{}, []string{second.Hash + "^!"})
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	if len(result.Files) != 2 {
+		t.Errorf("expected the second commit's 2 files, got %d", len(result.Files))
+	}
+}
+
+func TestListCommitsRejectsOptions(t *testing.T) {
+	dir := newTestRepo(t)
+	out := filepath.Join(t.TempDir(), "written")
+	for _, base := range []string{"", "--output=" + out, "no-such-branch"} {
+		if _, err := ListCommits(dir, base); !errors.Is(err, ErrInvalidRevision) {
+			t.Errorf("ListCommits(%q): expected ErrInvalidRevision, got %v", base, err)
+		}
+		if _, err := ResolveReviewRefs(dir, base); !errors.Is(err, ErrInvalidRevision) {
+			t.Errorf("ResolveReviewRefs(%q): expected ErrInvalidRevision, got %v", base, err)
+		}
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Error("git wrote the --output file")
+	}
+}
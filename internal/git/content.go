@@ -0,0 +1,240 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrStaleContent is returned by ReadBlob when a blob is neither in the
+// object database nor the working tree's current content, i.e. the file
+// changed after the diff naming it was computed.
+var ErrStaleContent = errors.New("file changed since the diff was computed; reload it")
+
+// ErrBlobTooLarge is returned by ReadBlobLimit for content over its limit.
+var ErrBlobTooLarge = errors.New("file is too large")
+
+// ReadBlob returns the content of blob, a FileDiff's OldBlob or NewBlob. Blobs
+// of commits and the index are read from the object database; the working
+// tree side of a diff is not stored there, so it is read from path (relative
+// to the repository root) after checking the file still hashes to blob.
+func ReadBlob(repoDir, path, blob string) ([]byte, error) {
+	object, file, err := locateBlob(repoDir, path, blob)
+	if err != nil {
+		return nil, err
+	}
+	return readLocated(repoDir, object, file)
+}
+
+// ReadBlobLimit is ReadBlob for content of at most limit bytes. It also
+// returns the content's size; when that exceeds limit, the content is not
+// read and ErrBlobTooLarge is returned.
+func ReadBlobLimit(repoDir, path, blob string, limit int64) ([]byte, int64, error) {
+	object, file, err := locateBlob(repoDir, path, blob)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := locatedSize(repoDir, object, file)
+	if err != nil {
+		return nil, 0, err
+	}
+	if size > limit {
+		return nil, size, ErrBlobTooLarge
+	}
+	data, err := readLocated(repoDir, object, file)
+	return data, size, err
+}
+
+// readLocated returns the content of a blob found by locateBlob.
+func readLocated(repoDir, object, file string) ([]byte, error) {
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	out, err := gitCmd{dir: repoDir, args: []string{"cat-file", "blob", object}}.run()
+	return []byte(out), err
+}
+
+// locateBlob finds blob as ReadBlob reads it: the full object ID if the
+// object database has it, otherwise the absolute path of the working tree
+// file that hashes to it.
+func locateBlob(repoDir, path, blob string) (object, file string, err error) {
+	if strings.Trim(blob, "0") == "" || !IsCommitID(blob) {
+		return "", "", fmt.Errorf("invalid blob %q", blob)
+	}
+	if full, err := runGit(repoDir, "rev-parse", "--verify", "-q", blob+"^{blob}"); err == nil {
+		return full, "", nil
+	}
+
+	if path == "" || !filepath.IsLocal(filepath.FromSlash(path)) {
+		return "", "", fmt.Errorf("invalid path %q", path)
+	}
+	top, err := runGit(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", err
+	}
+	// hash-object applies the path's clean filters (e.g. CRLF conversion),
+	// hashing the file as git diff did.
+	hash, err := runGit(top, "hash-object", "--", filepath.FromSlash(path))
+	if err != nil || !strings.HasPrefix(hash, strings.ToLower(blob)) {
+		return "", "", ErrStaleContent
+	}
+	return "", filepath.Join(top, filepath.FromSlash(path)), nil
+}
+
+// BlobAt returns the ID of the blob at path (relative to the repository
+// root) in rev, e.g. a base branch or commit.
+func BlobAt(repoDir, rev, path string) (string, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("invalid revision %q", rev)
+	}
+	blob, err := runGit(repoDir, "rev-parse", "--verify", "-q", rev+":"+path)
+	if err != nil {
+		return "", fmt.Errorf("%s not found in %s", path, rev)
+	}
+	return blob, nil
+}
+
+// BlobSize returns the size in bytes of blob, located as ReadBlob does.
+func BlobSize(repoDir, path, blob string) (int64, error) {
+	object, file, err := locateBlob(repoDir, path, blob)
+	if err != nil {
+		return 0, err
+	}
+	return locatedSize(repoDir, object, file)
+}
+
+// locatedSize returns the size of a blob found by locateBlob.
+func locatedSize(repoDir, object, file string) (int64, error) {
+	if file != "" {
+		info, err := os.Stat(file)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	size, err := runGit(repoDir, "cat-file", "-s", object)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(size, 10, 64)
+}
+
+// maxFileContentSize is the largest file ReadFileContent returns content for.
+const maxFileContentSize = 2 << 20
+
+// Values for FileContent.Encoding.
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "iso-8859-1" // fallback for text that is not valid UTF-8
+)
+
+// FileContent is one side of a file, decoded for display.
+type FileContent struct {
+	Path     string `json:"path"`
+	Blob     string `json:"blob"`
+	Size     int64  `json:"size"`
+	Binary   bool   `json:"binary,omitempty"`
+	TooLarge bool   `json:"tooLarge,omitempty"` // content omitted for exceeding the size cap
+	Encoding string `json:"encoding,omitempty"` // of the file's bytes; Content is always UTF-8
+	BOM      bool   `json:"bom,omitempty"`      // the file starts with a byte order mark, dropped from Content
+	Content  string `json:"content,omitempty"`
+}
+
+// ReadFileContent reads blob as ReadBlob does and decodes it as text. Binary
+// and oversized files are reported without content.
+func ReadFileContent(repoDir, path, blob string) (*FileContent, error) {
+	data, size, err := ReadBlobLimit(repoDir, path, blob, maxFileContentSize)
+	fc := &FileContent{Path: path, Blob: blob, Size: size}
+	if errors.Is(err, ErrBlobTooLarge) {
+		fc.TooLarge = true
+		return fc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	decodeContent(fc, data)
+	return fc, nil
+}
+
+// decodeContent sets fc's Content, Encoding and BOM from data, or Binary if
+// data is not text. UTF-16 is recognised by its byte order mark only, as its
+// NUL bytes would otherwise make it look binary.
+func decodeContent(fc *FileContent, data []byte) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		fc.Encoding, fc.BOM = EncodingUTF8, true
+		fc.Content = strings.ToValidUTF8(string(data[3:]), "\uFFFD")
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		fc.Encoding, fc.BOM = EncodingUTF16LE, true
+		fc.Content = decodeUTF16(data[2:], binary.LittleEndian)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		fc.Encoding, fc.BOM = EncodingUTF16BE, true
+		fc.Content = decodeUTF16(data[2:], binary.BigEndian)
+	case isBinary(data):
+		fc.Binary = true
+	case utf8.Valid(data):
+		fc.Encoding = EncodingUTF8
+		fc.Content = string(data)
+	default:
+		fc.Encoding = EncodingLatin1
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		fc.Content = string(runes)
+	}
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// BlobLines returns lines from..to (1-based, inclusive) of blob as read by
+// ReadBlob, and the content's total line count. The range is clamped to the
+// content, so to may be past the end. Content larger than ReadFileContent
+// returns yields ErrBlobTooLarge.
+func BlobLines(repoDir, path, blob string, from, to int) ([]string, int, error) {
+	content, size, err := ReadBlobLimit(repoDir, path, blob, maxFileContentSize)
+	if errors.Is(err, ErrBlobTooLarge) {
+		return nil, 0, fmt.Errorf("%s: %w (%d bytes)", path, err, size)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if isBinary(content) {
+		return nil, 0, fmt.Errorf("%s is a binary file", path)
+	}
+	lines := splitLines(string(content))
+	from = max(from, 1)
+	to = min(to, len(lines))
+	if from > to {
+		return []string{}, len(lines), nil
+	}
+	return lines[from-1 : to], len(lines), nil
+}
+
+// splitLines splits content into lines without their terminators; a final
+// newline does not start another line.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
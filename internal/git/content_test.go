@@ -0,0 +1,104 @@
+package git
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlobLines(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(30, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "thirty lines")
+	mustWrite(t, file, numberedLines(30, map[int]string{15: "changed 15"}))
+
+	result, err := DiffInRepo(dir, DiffOptions{}, nil)
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	f := result.Files[0]
+
+	// The old side is a committed blob, the new side the working tree file.
+	lines, total, err := BlobLines(dir, f.OldName, f.OldBlob, 1, 3)
+	if err != nil {
+		t.Fatalf("BlobLines old: %v", err)
+	}
+	if total != 30 || strings.Join(lines, ",") != "line 1,line 2,line 3" {
+		t.Errorf("old side = %q of %d", lines, total)
+	}
+	lines, total, err = BlobLines(dir, f.NewName, f.NewBlob, 14, 100)
+	if err != nil {
+		t.Fatalf("BlobLines new: %v", err)
+	}
+	if total != 30 || len(lines) != 17 || lines[1] != "changed 15" {
+		t.Errorf("new side = %q of %d", lines, total)
+	}
+
+	// Once the file changes again the diff's working tree blob is gone.
+	mustWrite(t, file, numberedLines(30, map[int]string{15: "changed again"}))
+	if _, _, err := BlobLines(dir, f.NewName, f.NewBlob, 1, 3); !errors.Is(err, ErrStaleContent) {
+		t.Errorf("expected ErrStaleContent, got %v", err)
+	}
+	if _, err := ReadBlob(dir, "../outside.txt", "abcdef1"); err == nil {
+		t.Error("expected a path outside the repository to be rejected")
+	}
+	if _, err := ReadBlob(dir, f.NewName, "0000000"); err == nil {
+		t.Error("expected the null blob to be rejected")
+	}
+
+	mustWrite(t, filepath.Join(dir, "big.txt"), strings.Repeat("x\n", maxFileContentSize/2+1))
+	mustGit(t, dir, "add", "big.txt")
+	big := strings.Fields(mustGit(t, dir, "ls-files", "-s", "big.txt"))[1]
+	if _, _, err := BlobLines(dir, "big.txt", big, 1, 3); !errors.Is(err, ErrBlobTooLarge) {
+		t.Errorf("expected ErrBlobTooLarge for a large blob, got %v", err)
+	}
+
+	data, size, err := ReadBlobLimit(dir, f.OldName, f.OldBlob, 1<<10)
+	if err != nil || size != int64(len(data)) || !strings.HasPrefix(string(data), "line 1\n") {
+		t.Errorf("ReadBlobLimit = %q, %d, %v", data, size, err)
+	}
+	if data, size, err := ReadBlobLimit(dir, f.OldName, f.OldBlob, 10); !errors.Is(err, ErrBlobTooLarge) || data != nil || size <= 10 {
+		t.Errorf("expected ErrBlobTooLarge with the size, got %q, %d, %v", data, size, err)
+	}
+}
+
+func TestReadFileContent(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, "utf16.txt"), "\xff\xfeh\x00i\x00\n\x00")
+	mustWrite(t, filepath.Join(dir, "latin1.txt"), "caf\xe9\n")
+	mustWrite(t, filepath.Join(dir, "bin.dat"), "a\x00b")
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "encodings")
+
+	cases := []struct {
+		path, encoding, content string
+		binary                  bool
+	}{
+		{"tracked.txt", EncodingUTF8, "one\n", false},
+		{"utf16.txt", EncodingUTF16LE, "hi\n", false},
+		{"latin1.txt", EncodingLatin1, "café\n", false},
+		{"bin.dat", "", "", true},
+	}
+	for _, c := range cases {
+		blob, err := BlobAt(dir, "HEAD", c.path)
+		if err != nil {
+			t.Fatalf("BlobAt %s: %v", c.path, err)
+		}
+		fc, err := ReadFileContent(dir, c.path, blob)
+		if err != nil {
+			t.Fatalf("ReadFileContent %s: %v", c.path, err)
+		}
+		if fc.Encoding != c.encoding || fc.Content != c.content || fc.Binary != c.binary {
+			t.Errorf("%s = %+v", c.path, fc)
+		}
+	}
+
+	if _, err := BlobAt(dir, "--output=x", "tracked.txt"); err == nil {
+		t.Error("expected an option-like revision to be rejected")
+	}
+	if _, err := BlobAt(dir, "HEAD", "missing.txt"); err == nil {
+		t.Error("expected a missing path to be reported")
+	}
+}
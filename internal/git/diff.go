@@ -5,6 +5,8 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+
+	"github.com/flatcoke/prview/internal/highlight"
 )
 
 // Hunk represents a single diff hunk.
@@ -14,24 +16,62 @@ type Hunk struct {
 	NewStart int    `json:"newStart"`
 	NewLines int    `json:"newLines"`
 	Header   string `json:"header"`
+	Hash     string `json:"hash"` // identifies the hunk's content for HunkRef.Hash
 	Lines    []Line `json:"lines"`
 }
 
 // Line represents a single line in a diff hunk.
 type Line struct {
-	Type    string `json:"type"` // "add", "del", "context"
-	Content string `json:"content"`
+	Type    string            `json:"type"` // "add", "del", "context"
+	Content string            `json:"content"`
+	Changes []Span            `json:"changes,omitempty"` // intra-line changed ranges for paired del/add lines
+	Tokens  []highlight.Token `json:"tokens,omitempty"`  // syntax highlighting, set by Highlight
 }
 
 // FileDiff represents the diff for a single file.
 type FileDiff struct {
 	OldName   string `json:"oldName"`
 	NewName   string `json:"newName"`
-	Status    string `json:"status"` // "modified", "added", "deleted", "renamed"
+	Status    string `json:"status"` // "modified", "added", "deleted", "renamed", "copied"
 	Additions int    `json:"additions"`
 	Deletions int    `json:"deletions"`
 	IsBinary  bool   `json:"isBinary"`
+	Untracked bool   `json:"untracked,omitempty"` // synthesised by AddUntracked; not yet known to git
+	TooLarge  bool   `json:"tooLarge,omitempty"`  // content omitted for exceeding the size cap
+	Layer     string `json:"layer,omitempty"`     // DiffLayers only: "staged" or "unstaged" — which diff these hunks are from
+	Stage     string `json:"stage,omitempty"`     // DiffLayers only: "staged", "unstaged" or "both"
+	OldBlob   string `json:"oldBlob,omitempty"`   // blob hash (possibly abbreviated) from the index line
+	NewBlob   string `json:"newBlob,omitempty"`   // blob hash (possibly abbreviated) from the index line
+	Viewed    bool   `json:"viewed,omitempty"`    // marked viewed since its content last changed
+	Language  string `json:"language,omitempty"`  // set by Highlight for files it recognises
+	Generated bool   `json:"generated,omitempty"` // linguist-generated or a well-known lockfile; set by MarkGenerated
+	Vendored  bool   `json:"vendored,omitempty"`  // linguist-vendored; set by MarkGenerated
+	NoDiff    bool   `json:"noDiff,omitempty"`    // -diff attribute, so git shows no content; set by MarkGenerated
 	Hunks     []Hunk `json:"hunks"`
+
+	OldMode    string     `json:"oldMode,omitempty"`    // e.g. "100644"; empty for an added file
+	NewMode    string     `json:"newMode,omitempty"`    // e.g. "100755"; empty for a deleted file
+	Similarity int        `json:"similarity,omitempty"` // percentage, for renames and copies
+	OldTarget  string     `json:"oldTarget,omitempty"`  // symlink target before, if the old side is a symlink
+	NewTarget  string     `json:"newTarget,omitempty"`  // symlink target after, if the new side is a symlink
+	Submodule  *Submodule `json:"submodule,omitempty"`  // set for submodule (gitlink) changes
+	OldSize    int64      `json:"oldSize,omitempty"`    // binary files only, in bytes; set by MeasureBinaries
+	NewSize    int64      `json:"newSize,omitempty"`    // binary files only, in bytes; set by MeasureBinaries
+}
+
+// File modes git reports for symlinks and submodules.
+const (
+	modeSymlink   = "120000"
+	modeSubmodule = "160000"
+)
+
+// Submodule describes a submodule's change of commit.
+type Submodule struct {
+	OldCommit string   `json:"oldCommit,omitempty"` // empty for an added submodule
+	NewCommit string   `json:"newCommit,omitempty"` // empty for a removed submodule
+	Dirty     bool     `json:"dirty,omitempty"`     // the submodule's work tree has changes
+	Commits   []Commit `json:"commits,omitempty"`   // OldCommit..NewCommit, oldest first; set by DescribeSubmodules
+	Omitted   int      `json:"omitted,omitempty"`   // commits beyond the listing cap
 }
 
 // DiffResult holds the complete diff output.
@@ -40,14 +80,40 @@ type DiffResult struct {
 	Additions int        `json:"additions"`
 	Deletions int        `json:"deletions"`
 	RawDiff   string     `json:"rawDiff"`
+
+	UntrackedOmitted int `json:"untrackedOmitted,omitempty"` // untracked files beyond the listing cap
+
+	Comments []Comment `json:"comments,omitempty"` // review comments on the current branch, anchored to this diff
+
+	ViewedFiles int `json:"viewedFiles"` // files marked viewed, out of TotalFiles
+	TotalFiles  int `json:"totalFiles"`
+
+	// Generated, vendored and -diff files, which the UI collapses. They are
+	// included in Files, Additions and Deletions as well.
+	CollapsedFiles     int `json:"collapsedFiles,omitempty"`
+	CollapsedAdditions int `json:"collapsedAdditions,omitempty"`
+	CollapsedDeletions int `json:"collapsedDeletions,omitempty"`
+
+	RangeDiff *RangeDiff `json:"rangeDiff,omitempty"` // range mode only: commit-by-commit comparison of two branch versions
+}
+
+// File returns the file in r at path (its new name, or old name if deleted)
+// and, for DiffLayers results, in layer; nil if there is none.
+func (r *DiffResult) File(path, layer string) *FileDiff {
+	for i := range r.Files {
+		if f := &r.Files[i]; filePath(*f) == path && f.Layer == layer {
+			return f
+		}
+	}
+	return nil
 }
 
 // gitDiffExitChanges is the exit code git diff uses when differences are found.
 const gitDiffExitChanges = 1
 
-// Diff runs git diff and returns parsed results.
-func Diff(args []string) (*DiffResult, error) {
-	cmdArgs := append([]string{"diff", "--unified=3", "--no-color"}, args...)
+// Diff runs git diff with opts and returns parsed results.
+func Diff(opts DiffOptions, args []string) (*DiffResult, error) {
+	cmdArgs := append(append([]string{"diff", "--no-color"}, opts.args()...), args...)
 	cmd := exec.Command("git", cmdArgs...)
 	out, err := cmd.Output()
 	if err != nil {
@@ -77,6 +143,7 @@ func Parse(raw string) *DiffResult {
 	lines := strings.Split(raw, "\n")
 	var current *FileDiff
 	var currentHunk *Hunk
+	prefixed := true // current's names carry a/ and b/ style prefixes
 
 	for i := 0; i < len(lines); i++ {
 		line := lines[i]
@@ -93,16 +160,10 @@ func Parse(raw string) *DiffResult {
 			current = &FileDiff{Status: "modified"}
 			currentHunk = nil
 
-			parts := strings.SplitN(line, " b/", 2)
-			if len(parts) == 2 {
-				current.NewName = parts[1]
-			}
-			aParts := strings.SplitN(line, " a/", 2)
-			if len(aParts) == 2 {
-				aName := strings.SplitN(aParts[1], " b/", 2)
-				if len(aName) > 0 {
-					current.OldName = aName[0]
-				}
+			current.OldName, current.NewName = splitDiffGitLine(line)
+			prefixed = hasPrefixes(current.OldName, current.NewName)
+			if prefixed {
+				current.OldName, current.NewName = stripPrefix(current.OldName), stripPrefix(current.NewName)
 			}
 			continue
 		}
@@ -112,23 +173,46 @@ func Parse(raw string) *DiffResult {
 		}
 
 		// File status lines.
-		if strings.HasPrefix(line, "new file mode") {
+		if strings.HasPrefix(line, "new file mode ") {
 			current.Status = "added"
 			current.OldName = "/dev/null"
+			current.NewMode = strings.TrimPrefix(line, "new file mode ")
 			continue
 		}
-		if strings.HasPrefix(line, "deleted file mode") {
+		if strings.HasPrefix(line, "deleted file mode ") {
 			current.Status = "deleted"
 			current.NewName = "/dev/null"
+			current.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+			continue
+		}
+		if strings.HasPrefix(line, "old mode ") {
+			current.OldMode = strings.TrimPrefix(line, "old mode ")
+			continue
+		}
+		if strings.HasPrefix(line, "new mode ") {
+			current.NewMode = strings.TrimPrefix(line, "new mode ")
+			continue
+		}
+		if strings.HasPrefix(line, "copy from ") {
+			current.Status = "copied"
+			current.OldName = unquotePath(strings.TrimPrefix(line, "copy from "))
+			continue
+		}
+		if strings.HasPrefix(line, "copy to ") {
+			current.NewName = unquotePath(strings.TrimPrefix(line, "copy to "))
+			continue
+		}
+		if strings.HasPrefix(line, "similarity index ") {
+			current.Similarity, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%"))
 			continue
 		}
 		if strings.HasPrefix(line, "rename from ") {
 			current.Status = "renamed"
-			current.OldName = strings.TrimPrefix(line, "rename from ")
+			current.OldName = unquotePath(strings.TrimPrefix(line, "rename from "))
 			continue
 		}
 		if strings.HasPrefix(line, "rename to ") {
-			current.NewName = strings.TrimPrefix(line, "rename to ")
+			current.NewName = unquotePath(strings.TrimPrefix(line, "rename to "))
 			continue
 		}
 		if strings.HasPrefix(line, "Binary files") {
@@ -136,15 +220,27 @@ func Parse(raw string) *DiffResult {
 			continue
 		}
 
-		// Skip --- and +++ lines.
-		if strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") {
+		// The ---/+++ lines name one path each, so they are more reliable
+		// than the "diff --git" line. Within a hunk they are content.
+		if currentHunk == nil && strings.HasPrefix(line, "--- ") {
+			current.OldName = headerPath(line[4:], prefixed)
+			continue
+		}
+		if currentHunk == nil && strings.HasPrefix(line, "+++ ") {
+			current.NewName = headerPath(line[4:], prefixed)
 			continue
 		}
-		// Skip index/mode lines.
-		if strings.HasPrefix(line, "index ") ||
-			strings.HasPrefix(line, "similarity index") ||
-			strings.HasPrefix(line, "old mode") ||
-			strings.HasPrefix(line, "new mode") {
+		if strings.HasPrefix(line, "index ") {
+			blobs, mode, _ := strings.Cut(strings.TrimPrefix(line, "index "), " ")
+			current.OldBlob, current.NewBlob, _ = strings.Cut(blobs, "..")
+			// The mode is given here only if it did not change.
+			if mode != "" {
+				current.OldMode, current.NewMode = mode, mode
+			}
+			continue
+		}
+		// Skip dissimilarity lines.
+		if strings.HasPrefix(line, "dissimilarity index") {
 			continue
 		}
 
@@ -185,9 +281,53 @@ func Parse(raw string) *DiffResult {
 		result.Files = append(result.Files, *current)
 	}
 
+	for i := range result.Files {
+		for j := range result.Files[i].Hunks {
+			h := &result.Files[i].Hunks[j]
+			annotateHunk(h)
+			h.Hash = hunkHash(h.rawLines())
+		}
+		describeSpecial(&result.Files[i])
+	}
+
 	return result
 }
 
+// describeSpecial sets the symlink targets or submodule commits of f, which
+// git diffs as the target or a "Subproject commit" line on each side.
+func describeSpecial(f *FileDiff) {
+	if f.OldMode == modeSubmodule || f.NewMode == modeSubmodule {
+		f.Submodule = &Submodule{}
+	}
+	for _, h := range f.Hunks {
+		for _, l := range h.Lines {
+			if l.Type == "context" {
+				continue
+			}
+			old := l.Type == "del"
+			switch {
+			case f.Submodule != nil:
+				commit, ok := strings.CutPrefix(l.Content, "Subproject commit ")
+				if !ok {
+					continue
+				}
+				if c, dirty := strings.CutSuffix(commit, "-dirty"); dirty {
+					commit, f.Submodule.Dirty = c, true
+				}
+				if old {
+					f.Submodule.OldCommit = commit
+				} else {
+					f.Submodule.NewCommit = commit
+				}
+			case old && f.OldMode == modeSymlink:
+				f.OldTarget = l.Content
+			case !old && f.NewMode == modeSymlink:
+				f.NewTarget = l.Content
+			}
+		}
+	}
+}
+
 func parseHunkHeader(header string, hunk *Hunk) {
 	// @@ -oldStart,oldLines +newStart,newLines @@
 	header = strings.TrimPrefix(header, "@@ ")
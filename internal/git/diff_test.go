@@ -1,6 +1,8 @@
 package git
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -129,3 +131,218 @@ index abc..def 100644
 		t.Errorf("unexpected names: %q → %q", f.OldName, f.NewName)
 	}
 }
+
+func TestParseInlineChanges(t *testing.T) {
+	raw := `diff --git a/main.go b/main.go
+index abc..def 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@
+ package main
+-var count = 1
++var total = 1
+-x
++completely different text here
+`
+	result := Parse(raw)
+	lines := result.Files[0].Hunks[0].Lines
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got %d", len(lines))
+	}
+
+	del, add := lines[1], lines[2]
+	if len(del.Changes) != 1 || del.Content[del.Changes[0].Start:del.Changes[0].End] != "count" {
+		t.Errorf("del spans: got %+v", del.Changes)
+	}
+	if len(add.Changes) != 1 || add.Content[add.Changes[0].Start:add.Changes[0].End] != "total" {
+		t.Errorf("add spans: got %+v", add.Changes)
+	}
+
+	// Second pair shares nothing, so neither side gets spans.
+	if lines[3].Changes != nil || lines[4].Changes != nil {
+		t.Errorf("dissimilar pair should have no spans: %+v / %+v", lines[3].Changes, lines[4].Changes)
+	}
+	if lines[0].Changes != nil {
+		t.Errorf("context line should have no spans")
+	}
+}
+
+func TestParsePaths(t *testing.T) {
+	tests := []struct {
+		name             string
+		raw              string
+		oldName, newName string
+		status           string
+	}{
+		{
+			name: "space",
+			raw: "diff --git a/my file.go b/my file.go\nindex abc..def 100644\n" +
+				"--- a/my file.go\t\n+++ b/my file.go\t\n@@ -1 +1 @@\n-a\n+b\n",
+			oldName: "my file.go", newName: "my file.go", status: "modified",
+		},
+		{
+			name: "b/ inside path",
+			raw: "diff --git a/x b/y.go b/x b/y.go\nindex abc..def 100644\n" +
+				"--- a/x b/y.go\t\n+++ b/x b/y.go\t\n@@ -1 +1 @@\n-a\n+b\n",
+			oldName: "x b/y.go", newName: "x b/y.go", status: "modified",
+		},
+		{
+			name:    "b/ inside path without ---/+++",
+			raw:     "diff --git a/x b/y.bin b/x b/y.bin\nindex abc..def 100644\nBinary files a/x b/y.bin and b/x b/y.bin differ\n",
+			oldName: "x b/y.bin", newName: "x b/y.bin", status: "modified",
+		},
+		{
+			name: "quoted unicode",
+			raw: "diff --git \"a/\\303\\251t\\303\\251.go\" \"b/\\303\\251t\\303\\251.go\"\nindex abc..def 100644\n" +
+				"--- \"a/\\303\\251t\\303\\251.go\"\n+++ \"b/\\303\\251t\\303\\251.go\"\n@@ -1 +1 @@\n-a\n+b\n",
+			oldName: "été.go", newName: "été.go", status: "modified",
+		},
+		{
+			name: "quoted tab and quote",
+			raw: "diff --git \"a/tab\\there\" \"b/say \\\"hi\\\"\"\nsimilarity index 100%\n" +
+				"rename from \"tab\\there\"\nrename to \"say \\\"hi\\\"\"\n",
+			oldName: "tab\there", newName: `say "hi"`, status: "renamed",
+		},
+		{
+			name: "rename with spaces",
+			raw: "diff --git a/old name.go b/new name.go\nsimilarity index 90%\n" +
+				"rename from old name.go\nrename to new name.go\nindex abc..def 100644\n" +
+				"--- a/old name.go\t\n+++ b/new name.go\t\n@@ -1 +1 @@\n-a\n+b\n",
+			oldName: "old name.go", newName: "new name.go", status: "renamed",
+		},
+		{
+			name: "added",
+			raw: "diff --git a/new file.go b/new file.go\nnew file mode 100644\nindex 0000000..def\n" +
+				"--- /dev/null\n+++ b/new file.go\t\n@@ -0,0 +1 @@\n+a\n",
+			oldName: "/dev/null", newName: "new file.go", status: "added",
+		},
+		{
+			name: "deleted",
+			raw: "diff --git a/old.go b/old.go\ndeleted file mode 100644\nindex abc..0000000\n" +
+				"--- a/old.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n",
+			oldName: "old.go", newName: "/dev/null", status: "deleted",
+		},
+		{
+			name: "no prefix",
+			raw: "diff --git a/x a/x\nindex abc..def 100644\n" +
+				"--- a/x\n+++ a/x\n@@ -1 +1 @@\n-a\n+b\n",
+			oldName: "a/x", newName: "a/x", status: "modified",
+		},
+		{
+			name: "no prefix with space",
+			raw: "diff --git src/my file.go src/my file.go\nindex abc..def 100644\n" +
+				"--- src/my file.go\t\n+++ src/my file.go\t\n@@ -1 +1 @@\n-a\n+b\n",
+			oldName: "src/my file.go", newName: "src/my file.go", status: "modified",
+		},
+		{
+			name: "mnemonic prefix",
+			raw: "diff --git i/main.go w/main.go\nindex abc..def 100644\n" +
+				"--- i/main.go\n+++ w/main.go\n@@ -1 +1 @@\n-a\n+b\n",
+			oldName: "main.go", newName: "main.go", status: "modified",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Parse(tt.raw)
+			if len(result.Files) != 1 {
+				t.Fatalf("expected 1 file, got %d", len(result.Files))
+			}
+			f := result.Files[0]
+			if f.OldName != tt.oldName || f.NewName != tt.newName || f.Status != tt.status {
+				t.Errorf("got %q → %q (%s), want %q → %q (%s)", f.OldName, f.NewName, f.Status, tt.oldName, tt.newName, tt.status)
+			}
+		})
+	}
+}
+
+func TestParseHeaderLikeContent(t *testing.T) {
+	raw := "diff --git a/notes.md b/notes.md\nindex abc..def 100644\n" +
+		"--- a/notes.md\n+++ b/notes.md\n@@ -1,2 +1,2 @@\n--- rule\n+++ rule\n context\n"
+	f := Parse(raw).Files[0]
+	if f.OldName != "notes.md" || f.NewName != "notes.md" {
+		t.Errorf("names: got %q → %q", f.OldName, f.NewName)
+	}
+	if f.Additions != 1 || f.Deletions != 1 || len(f.Hunks[0].Lines) != 3 {
+		t.Errorf("expected the -- and ++ lines as content, got %+v", f.Hunks)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	raw := `diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+diff --git a/a.go b/b.go
+similarity index 87%
+copy from a.go
+copy to b.go
+index abc..def 100644
+--- a/a.go
++++ b/b.go
+@@ -1 +1 @@
+-a
++b
+diff --git a/link b/link
+index abc..def 120000
+--- a/link
++++ b/link
+@@ -1 +1 @@
+-old/target
+\ No newline at end of file
++new/target
+\ No newline at end of file
+diff --git a/lib b/lib
+index abc..def 160000
+--- a/lib
++++ b/lib
+@@ -1 +1 @@
+-Subproject commit 1111111111111111111111111111111111111111
++Subproject commit 2222222222222222222222222222222222222222-dirty
+`
+	files := Parse(raw).Files
+	if len(files) != 4 {
+		t.Fatalf("expected 4 files, got %d", len(files))
+	}
+	if f := files[0]; f.OldMode != "100644" || f.NewMode != "100755" || f.Status != "modified" {
+		t.Errorf("mode change: got %+v", f)
+	}
+	if f := files[1]; f.Status != "copied" || f.OldName != "a.go" || f.NewName != "b.go" || f.Similarity != 87 {
+		t.Errorf("copy: got %+v", f)
+	}
+	if f := files[2]; f.OldTarget != "old/target" || f.NewTarget != "new/target" || f.OldMode != "120000" {
+		t.Errorf("symlink: got %+v", f)
+	}
+	sub := files[3].Submodule
+	if sub == nil || sub.OldCommit != strings.Repeat("1", 40) || sub.NewCommit != strings.Repeat("2", 40) || !sub.Dirty {
+		t.Errorf("submodule: got %+v", sub)
+	}
+	if files[0].Submodule != nil || files[2].Submodule != nil {
+		t.Error("only gitlinks should have Submodule set")
+	}
+}
+
+func TestDiffFindsCopies(t *testing.T) {
+	dir := newTestRepo(t)
+	body := numberedLines(20, nil)
+	mustWrite(t, filepath.Join(dir, "a.go"), body)
+	mustGit(t, dir, "add", "a.go")
+	mustGit(t, dir, "commit", "-q", "-m", "add a.go")
+
+	// Git looks for copy sources among the files a diff modifies.
+	mustWrite(t, filepath.Join(dir, "a.go"), body+"21\n")
+	mustWrite(t, filepath.Join(dir, "b.go"), body+"copied\n")
+	mustGit(t, dir, "add", "-A")
+
+	result, err := DiffInRepo(dir, DiffOptions{}, []string{"--cached"})
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	var copied *FileDiff
+	for i := range result.Files {
+		if result.Files[i].NewName == "b.go" {
+			copied = &result.Files[i]
+		}
+	}
+	if copied == nil || copied.Status != "copied" || copied.OldName != "a.go" || copied.Similarity == 0 {
+		t.Fatalf("expected b.go copied from a.go, got %+v", copied)
+	}
+}
@@ -0,0 +1,54 @@
+package git
+
+import "path"
+
+// lockfiles are well-known generated files treated as linguist-generated
+// unless .gitattributes says otherwise.
+var lockfiles = map[string]bool{
+	"go.sum":            true,
+	"package-lock.json": true,
+	"yarn.lock":         true,
+	"pnpm-lock.yaml":    true,
+	"Cargo.lock":        true,
+}
+
+// MarkGenerated sets Generated, Vendored and NoDiff on result's files from
+// their linguist-generated, linguist-vendored and diff attributes, treating
+// lockfiles as generated unless an attribute unsets it, and totals such files
+// in the Collapsed fields. Their lines stay counted in the overall totals.
+func MarkGenerated(repoDir string, result *DiffResult) error {
+	paths := make([]string, len(result.Files))
+	for i, f := range result.Files {
+		paths[i] = filePath(f)
+	}
+	attrs, err := checkAttrs(repoDir, []string{"linguist-generated", "linguist-vendored", "diff"}, paths)
+	if err != nil {
+		return err
+	}
+	result.CollapsedFiles, result.CollapsedAdditions, result.CollapsedDeletions = 0, 0, 0
+	for i := range result.Files {
+		f := &result.Files[i]
+		a := attrs[paths[i]]
+		f.Generated = attrTrue(a["linguist-generated"], lockfiles[path.Base(paths[i])])
+		f.Vendored = attrTrue(a["linguist-vendored"], false)
+		f.NoDiff = a["diff"] == "unset"
+		if f.Generated || f.Vendored || f.NoDiff {
+			result.CollapsedFiles++
+			result.CollapsedAdditions += f.Additions
+			result.CollapsedDeletions += f.Deletions
+		}
+	}
+	return nil
+}
+
+// attrTrue interprets a boolean attribute as Linguist does: set or "true"
+// turns it on, unset or "false" off, and an unspecified attribute keeps def.
+func attrTrue(value string, def bool) bool {
+	switch value {
+	case "set", "true":
+		return true
+	case "unset", "false":
+		return false
+	}
+	return def
+}
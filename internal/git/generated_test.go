@@ -0,0 +1,51 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMarkGenerated(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, ".gitattributes"),
+		"*.pb.go linguist-generated\nthird_party/** linguist-vendored\n*.snap -diff\nCargo.lock -linguist-generated\n")
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "attributes")
+	for name, content := range map[string]string{
+		"api.pb.go":       "package api\n",
+		"third_party/x.c": "int x;\n",
+		"ui.snap":         "snapshot\n",
+		"web/yarn.lock":   "a\nb\n",
+		"Cargo.lock":      "c\n",
+		"tracked.txt":     "two\n",
+	} {
+		mustWrite(t, filepath.Join(dir, name), content)
+	}
+	mustGit(t, dir, "add", ".")
+
+	result, err := DiffInRepo(dir, DiffOptions{}, []string{"--cached"})
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	if err := MarkGenerated(dir, result); err != nil {
+		t.Fatalf("MarkGenerated: %v", err)
+	}
+	type marks struct{ generated, vendored, noDiff bool }
+	want := map[string]marks{
+		"api.pb.go":       {generated: true},
+		"third_party/x.c": {vendored: true},
+		"ui.snap":         {noDiff: true},
+		"web/yarn.lock":   {generated: true},
+		"Cargo.lock":      {},
+		"tracked.txt":     {},
+	}
+	for _, f := range result.Files {
+		if got := (marks{f.Generated, f.Vendored, f.NoDiff}); got != want[f.NewName] {
+			t.Errorf("%s = %+v, want %+v", f.NewName, got, want[f.NewName])
+		}
+	}
+	// api.pb.go, x.c and yarn.lock add 4 lines; ui.snap has no line counts.
+	if result.CollapsedFiles != 4 || result.CollapsedAdditions != 4 || result.Additions != 6 {
+		t.Errorf("collapsed %d files +%d of +%d", result.CollapsedFiles, result.CollapsedAdditions, result.Additions)
+	}
+}
@@ -0,0 +1,212 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/flatcoke/prview/internal/highlight"
+)
+
+// Limits for Highlight, which reads both sides of every file it colours.
+const (
+	// maxHighlightFiles caps how many files of a diff are highlighted.
+	maxHighlightFiles = 300
+	// maxHighlightSize is the largest file content that is tokenised.
+	maxHighlightSize = 1 << 20
+)
+
+// Highlight sets Language and the lines' Tokens for the text files in result.
+// The language comes from a linguist-language attribute in .gitattributes,
+// else the file name or a "#!" line. Each side of a file is tokenised whole,
+// so lines inside multi-line strings and comments are coloured as such, and
+// the tokens are copied to the diff lines showing them. Highlighting is best
+// effort: files whose content cannot be read are left plain.
+func Highlight(repoDir string, result *DiffResult) {
+	var files []*FileDiff
+	var paths []string
+	for i := range result.Files {
+		f := &result.Files[i]
+		if !f.IsBinary && len(f.Hunks) > 0 && len(files) < maxHighlightFiles {
+			files = append(files, f)
+			paths = append(paths, filePath(*f))
+		}
+	}
+	attrs, _ := checkAttrs(repoDir, []string{"linguist-language"}, paths)
+	texts := readHighlightTexts(repoDir, files)
+
+	for _, f := range files {
+		oldText := texts.side(f.OldName, f.OldBlob)
+		newText := texts.side(f.NewName, f.NewBlob)
+
+		lang := highlight.Lookup(attrs[filePath(*f)]["linguist-language"])
+		if lang == "" {
+			first, _, _ := strings.Cut(newText+oldText, "\n")
+			lang = highlight.Detect(filePath(*f), first)
+		}
+		if lang == "" {
+			continue
+		}
+		f.Language = lang
+		highlightHunks(f, lang, oldText, newText)
+	}
+}
+
+// highlightTexts holds the text of the sides of the files being highlighted:
+// blobs by the object ID the diff names them by, and working tree files,
+// whose content is not in the object database, by path.
+type highlightTexts struct {
+	blobs map[string]string
+	files map[string]string
+}
+
+// side returns the text of the side of a file at path with blob, or "" if it
+// is absent, unreadable, binary or too large.
+func (t highlightTexts) side(path, blob string) string {
+	if path == "/dev/null" || !isBlobID(blob) {
+		return ""
+	}
+	if text, ok := t.blobs[blob]; ok {
+		return text
+	}
+	return t.files[path]
+}
+
+// isBlobID reports whether blob is an (abbreviated) object ID other than
+// git's all-zero one for a missing side.
+func isBlobID(blob string) bool {
+	return strings.Trim(blob, "0") != "" && IsCommitID(blob)
+}
+
+// readHighlightTexts reads both sides of files with a fixed number of git
+// runs: committed and staged sides through git cat-file, and sides not in
+// the object database from the working tree. The working tree files are not
+// checked against the diff's object IDs; highlightHunks skips any line whose
+// text does not match.
+func readHighlightTexts(repoDir string, files []*FileDiff) highlightTexts {
+	t := highlightTexts{blobs: map[string]string{}, files: map[string]string{}}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, f := range files {
+		for _, blob := range []string{f.OldBlob, f.NewBlob} {
+			if isBlobID(blob) && !seen[blob] {
+				seen[blob] = true
+				ids = append(ids, blob)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return t
+	}
+
+	// Sizes first, so that large blobs are never read.
+	out, err := gitCmd{dir: repoDir, stdin: strings.Join(ids, "\n") + "\n", args: []string{"cat-file", "--batch-check"}}.run()
+	if err != nil {
+		return t
+	}
+	var wanted, wantedIDs []string
+	missing := make(map[string]bool)
+	for i, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if i >= len(ids) {
+			break
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[1] == "blob":
+			if size, err := strconv.Atoi(fields[2]); err == nil && size <= maxHighlightSize {
+				wanted = append(wanted, fields[0])
+				wantedIDs = append(wantedIDs, ids[i])
+			}
+		case len(fields) == 2 && fields[1] == "missing":
+			missing[ids[i]] = true
+		}
+	}
+	if len(wanted) > 0 {
+		out, err := gitCmd{dir: repoDir, stdin: strings.Join(wanted, "\n") + "\n", args: []string{"cat-file", "--batch"}}.run()
+		if err == nil {
+			contents := parseCatFileBatch(out)
+			for i, object := range wanted {
+				if content, ok := contents[object]; ok && !isBinary([]byte(content)) {
+					t.blobs[wantedIDs[i]] = content
+				}
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		return t
+	}
+	top, err := runGit(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return t
+	}
+	for _, f := range files {
+		if !missing[f.NewBlob] || f.NewName == "/dev/null" || !filepath.IsLocal(filepath.FromSlash(f.NewName)) {
+			continue
+		}
+		full := filepath.Join(top, filepath.FromSlash(f.NewName))
+		if info, err := os.Lstat(full); err != nil || !info.Mode().IsRegular() || info.Size() > maxHighlightSize {
+			continue
+		}
+		if data, err := os.ReadFile(full); err == nil && !isBinary(data) {
+			t.files[f.NewName] = string(data)
+		}
+	}
+	return t
+}
+
+// parseCatFileBatch returns the contents of the objects in git cat-file
+// --batch output by full object ID. Objects reported missing are skipped.
+func parseCatFileBatch(out string) map[string]string {
+	contents := make(map[string]string)
+	for out != "" {
+		header, rest, ok := strings.Cut(out, "\n")
+		if !ok {
+			break
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			out = rest
+			continue
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil || size+1 > len(rest) {
+			break
+		}
+		contents[fields[0]] = rest[:size]
+		out = rest[size+1:]
+	}
+	return contents
+}
+
+// highlightHunks copies the tokens of oldText and newText to f's deleted and
+// added/context lines by line number. A line is skipped if the content it
+// was tokenised from differs, as when the diff ignores whitespace.
+func highlightHunks(f *FileDiff, lang, oldText, newText string) {
+	oldTokens, newTokens := highlight.Tokenize(lang, oldText), highlight.Tokenize(lang, newText)
+	oldLines, newLines := splitLines(oldText), splitLines(newText)
+	for h := range f.Hunks {
+		hunk := &f.Hunks[h]
+		oldNum, newNum := hunk.OldStart, hunk.NewStart
+		for i := range hunk.Lines {
+			line := &hunk.Lines[i]
+			tokens, text, num := newTokens, newLines, newNum
+			if line.Type == "del" {
+				tokens, text, num = oldTokens, oldLines, oldNum
+			}
+			if num >= 1 && num <= len(tokens) && num <= len(text) && text[num-1] == strings.TrimSuffix(line.Content, "\r") {
+				line.Tokens = tokens[num-1]
+			}
+			switch line.Type {
+			case "del":
+				oldNum++
+			case "add":
+				newNum++
+			default:
+				oldNum++
+				newNum++
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, "main.go"), "package main\n\n/*\nold\n*/\nvar x = 1\n")
+	mustWrite(t, filepath.Join(dir, "script"), "#!/bin/sh\necho hi\n")
+	mustWrite(t, filepath.Join(dir, "query.txt"), "select 1;\n")
+	mustWrite(t, filepath.Join(dir, ".gitattributes"), "*.txt linguist-language=SQL\n")
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "sources")
+	mustWrite(t, filepath.Join(dir, "main.go"), "package main\n\n/*\nnew\n*/\nvar x = 1\n")
+	mustWrite(t, filepath.Join(dir, "script"), "#!/bin/sh\necho bye\n")
+	mustWrite(t, filepath.Join(dir, "query.txt"), "select 2;\n")
+
+	result, err := DiffInRepo(dir, DiffOptions{}, nil)
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	Highlight(dir, result)
+
+	langs := map[string]string{}
+	for _, f := range result.Files {
+		langs[f.NewName] = f.Language
+	}
+	if langs["main.go"] != "go" || langs["script"] != "shell" || langs["query.txt"] != "sql" {
+		t.Errorf("unexpected languages %v", langs)
+	}
+
+	// The changed lines sit inside a block comment opened above the hunk's
+	// first changed line; both sides are coloured from their whole file.
+	for _, f := range result.Files {
+		if f.NewName != "main.go" {
+			continue
+		}
+		for _, line := range f.Hunks[0].Lines {
+			if line.Type == "context" {
+				continue
+			}
+			if len(line.Tokens) != 1 || line.Tokens[0].Class != "comment" {
+				t.Errorf("%s line %q tokens = %+v", line.Type, line.Content, line.Tokens)
+			}
+		}
+	}
+}
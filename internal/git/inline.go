@@ -0,0 +1,179 @@
+package git
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Span marks a changed region within a Line's Content as a half-open
+// [Start, End) byte range.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// maxInlineTokens caps the token count per line for intra-line diffing.
+// The LCS table is O(n*m), so very long lines (minified JS, lockfiles) are
+// left without spans rather than stalling the response.
+const maxInlineTokens = 500
+
+// minInlineSimilarity is the fraction of unchanged bytes a del/add pair must
+// share before spans are emitted. Below this the lines are effectively
+// rewritten and highlighting every token only adds noise.
+const minInlineSimilarity = 0.4
+
+// annotateHunk pairs each run of deleted lines with the run of added lines
+// that immediately follows it and fills in Changes on both sides.
+// Lines are paired positionally (first del with first add, and so on);
+// surplus lines in the longer run are left without spans.
+func annotateHunk(h *Hunk) {
+	lines := h.Lines
+	for i := 0; i < len(lines); {
+		if lines[i].Type != "del" {
+			i++
+			continue
+		}
+		delStart := i
+		for i < len(lines) && lines[i].Type == "del" {
+			i++
+		}
+		addStart := i
+		for i < len(lines) && lines[i].Type == "add" {
+			i++
+		}
+		nDel, nAdd := addStart-delStart, i-addStart
+		for k := 0; k < nDel && k < nAdd; k++ {
+			del, add := &lines[delStart+k], &lines[addStart+k]
+			del.Changes, add.Changes = inlineChanges(del.Content, add.Content)
+		}
+	}
+}
+
+// inlineChanges returns the changed spans of old and new, computed as the
+// complement of the longest common subsequence of their tokens.
+// Both results are nil when the lines are identical, too long to compare,
+// or too dissimilar for highlighting to be useful.
+func inlineChanges(oldText, newText string) ([]Span, []Span) {
+	if oldText == newText {
+		return nil, nil
+	}
+	a, b := tokenize(oldText), tokenize(newText)
+	if len(a) > maxInlineTokens || len(b) > maxInlineTokens {
+		return nil, nil
+	}
+
+	keepA, keepB := lcsTokens(a, b)
+
+	common := 0
+	for i, keep := range keepA {
+		if keep {
+			common += len(a[i].text)
+		}
+	}
+	longest := len(oldText)
+	if len(newText) > longest {
+		longest = len(newText)
+	}
+	if float64(common)/float64(longest) < minInlineSimilarity {
+		return nil, nil
+	}
+
+	return changedSpans(a, keepA), changedSpans(b, keepB)
+}
+
+// token is a lexical unit of a line together with its byte offset.
+type token struct {
+	text  string
+	start int
+}
+
+// tokenize splits s into words (letters, digits and underscores), runs of
+// whitespace, and single punctuation characters, so that an edit inside an
+// identifier highlights the identifier and an edit to an operator highlights
+// just the operator.
+func tokenize(s string) []token {
+	var tokens []token
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		j := i + size
+		switch {
+		case isWordRune(r):
+			for j < len(s) {
+				r2, n := utf8.DecodeRuneInString(s[j:])
+				if !isWordRune(r2) {
+					break
+				}
+				j += n
+			}
+		case unicode.IsSpace(r):
+			for j < len(s) {
+				r2, n := utf8.DecodeRuneInString(s[j:])
+				if !unicode.IsSpace(r2) {
+					break
+				}
+				j += n
+			}
+		}
+		tokens = append(tokens, token{text: s[i:j], start: i})
+		i = j
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lcsTokens reports, for each token of a and b, whether it is part of the
+// longest common subsequence of the two token lists.
+func lcsTokens(a, b []token) ([]bool, []bool) {
+	n, m := len(a), len(b)
+	// dp[i][j] is the LCS length of a[i:] and b[j:].
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i].text == b[j].text {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] >= dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	keepA, keepB := make([]bool, n), make([]bool, m)
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case a[i].text == b[j].text:
+			keepA[i], keepB[j] = true, true
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return keepA, keepB
+}
+
+// changedSpans merges consecutive tokens not marked as kept into spans.
+func changedSpans(tokens []token, keep []bool) []Span {
+	var spans []Span
+	for i, t := range tokens {
+		if keep[i] {
+			continue
+		}
+		end := t.start + len(t.text)
+		if n := len(spans); n > 0 && spans[n-1].End == t.start {
+			spans[n-1].End = end
+			continue
+		}
+		spans = append(spans, Span{Start: t.start, End: end})
+	}
+	return spans
+}
@@ -0,0 +1,126 @@
+package git
+
+import "strings"
+
+// Values for FileDiff.Layer and FileDiff.Stage.
+const (
+	LayerStaged   = "staged"   // index vs HEAD
+	LayerUnstaged = "unstaged" // working tree vs index
+	StageBoth     = "both"     // file has both staged and unstaged changes
+)
+
+// DiffLayers returns the staged (index vs HEAD) and unstaged (working tree vs
+// index) diffs of repoDir in one result. Each FileDiff has Layer set to the
+// diff it came from and Stage set to the file's overall state; a file with
+// changes in both layers appears twice, staged entry first, with Stage "both".
+// If repoDir is empty, git runs in the current working directory.
+func DiffLayers(repoDir string, opts DiffOptions) (*DiffResult, error) {
+	staged, err := DiffInRepo(repoDir, opts, []string{"--cached"})
+	if err != nil {
+		return nil, err
+	}
+	unstaged, err := DiffInRepo(repoDir, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return mergeLayers(staged, unstaged), nil
+}
+
+// layerEntry is one file's diff from one layer, with its raw text.
+type layerEntry struct {
+	file  FileDiff
+	raw   string
+	layer string
+}
+
+// mergeLayers interleaves the files of the staged and unstaged results so that
+// both layers of a file are adjacent, keeping RawDiff in the same order as
+// Files so that renderers indexing either stay in step.
+func mergeLayers(staged, unstaged *DiffResult) *DiffResult {
+	result := &DiffResult{
+		Additions: staged.Additions + unstaged.Additions,
+		Deletions: staged.Deletions + unstaged.Deletions,
+	}
+
+	stagedEntries := layerEntries(staged, LayerStaged)
+	unstagedEntries := layerEntries(unstaged, LayerUnstaged)
+
+	unstagedByPath := make(map[string]int, len(unstagedEntries))
+	for i, e := range unstagedEntries {
+		unstagedByPath[filePath(e.file)] = i
+	}
+
+	var ordered []layerEntry
+	used := make(map[int]bool)
+	for _, e := range stagedEntries {
+		e.file.Stage = LayerStaged
+		if i, ok := unstagedByPath[filePath(e.file)]; ok && !used[i] {
+			used[i] = true
+			u := unstagedEntries[i]
+			e.file.Stage, u.file.Stage = StageBoth, StageBoth
+			ordered = append(ordered, e, u)
+			continue
+		}
+		ordered = append(ordered, e)
+	}
+	for i, u := range unstagedEntries {
+		if !used[i] {
+			u.file.Stage = LayerUnstaged
+			ordered = append(ordered, u)
+		}
+	}
+
+	var raw strings.Builder
+	for _, e := range ordered {
+		e.file.Layer = e.layer
+		result.Files = append(result.Files, e.file)
+		raw.WriteString(e.raw)
+	}
+	result.RawDiff = raw.String()
+	return result
+}
+
+// layerEntries pairs each parsed file of r with its slice of r.RawDiff.
+func layerEntries(r *DiffResult, layer string) []layerEntry {
+	chunks := splitRawFiles(r.RawDiff)
+	entries := make([]layerEntry, 0, len(r.Files))
+	for i, f := range r.Files {
+		e := layerEntry{file: f, layer: layer}
+		if i < len(chunks) {
+			e.raw = chunks[i]
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// splitRawFiles splits raw diff output into one chunk per "diff --git" section.
+func splitRawFiles(raw string) []string {
+	var chunks []string
+	start := -1
+	for i := 0; i < len(raw); {
+		if strings.HasPrefix(raw[i:], "diff --git ") {
+			if start >= 0 {
+				chunks = append(chunks, raw[start:i])
+			}
+			start = i
+		}
+		next := strings.IndexByte(raw[i:], '\n')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	if start >= 0 {
+		chunks = append(chunks, raw[start:])
+	}
+	return chunks
+}
+
+// filePath returns the path that identifies f in the working tree.
+func filePath(f FileDiff) string {
+	if f.Status == "deleted" {
+		return f.OldName
+	}
+	return f.NewName
+}
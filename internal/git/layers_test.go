@@ -0,0 +1,61 @@
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffLayers(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, "b.txt"), "b\n")
+	mustWrite(t, filepath.Join(dir, "c.txt"), "c\n")
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "more")
+
+	// tracked.txt: staged and unstaged; b.txt: staged only; c.txt: unstaged only.
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "two\n")
+	mustWrite(t, filepath.Join(dir, "b.txt"), "bb\n")
+	mustGit(t, dir, "add", "tracked.txt", "b.txt")
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "three\n")
+	mustWrite(t, filepath.Join(dir, "c.txt"), "cc\n")
+
+	result, err := DiffLayers(dir, DiffOptions{})
+	if err != nil {
+		t.Fatalf("DiffLayers: %v", err)
+	}
+
+	type entry struct{ name, layer, stage string }
+	want := []entry{
+		{"b.txt", LayerStaged, LayerStaged},
+		{"tracked.txt", LayerStaged, StageBoth},
+		{"tracked.txt", LayerUnstaged, StageBoth},
+		{"c.txt", LayerUnstaged, LayerUnstaged},
+	}
+	if len(result.Files) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(result.Files))
+	}
+	for i, w := range want {
+		f := result.Files[i]
+		if f.NewName != w.name || f.Layer != w.layer || f.Stage != w.stage {
+			t.Errorf("entry %d: got %s/%s/%s, want %s/%s/%s", i, f.NewName, f.Layer, f.Stage, w.name, w.layer, w.stage)
+		}
+	}
+	if result.Additions != 4 || result.Deletions != 4 {
+		t.Errorf("expected +4/-4, got +%d/-%d", result.Additions, result.Deletions)
+	}
+
+	// RawDiff must follow the same order as Files.
+	chunks := splitRawFiles(result.RawDiff)
+	if len(chunks) != len(want) {
+		t.Fatalf("expected %d raw chunks, got %d", len(want), len(chunks))
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(chunks[i], "diff --git a/"+w.name) {
+			t.Errorf("raw chunk %d out of order: %q", i, strings.SplitN(chunks[i], "\n", 2)[0])
+		}
+	}
+	if !strings.Contains(chunks[1], "+two") || !strings.Contains(chunks[2], "+three") {
+		t.Errorf("tracked.txt layers swapped")
+	}
+}
@@ -0,0 +1,96 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Values for DiffOptions.Whitespace.
+const (
+	WhitespaceAll    = "all"    // ignore all whitespace (git diff -w)
+	WhitespaceChange = "change" // ignore changes in amount of whitespace (git diff -b)
+)
+
+// defaultContext is the number of context lines when DiffOptions.Context is nil.
+const defaultContext = 3
+
+// maxContext bounds DiffOptions.Context; beyond it whole files are cheaper
+// to fetch with a full-file view.
+const maxContext = 1000
+
+// ErrWhitespaceHunk is returned when a hunk is staged, unstaged or discarded
+// from a diff that ignores whitespace: its lines do not match the file, so it
+// cannot be applied.
+var ErrWhitespaceHunk = errors.New("hunks cannot be applied while whitespace changes are ignored")
+
+// DiffOptions controls how git computes a diff. The zero value is git's
+// default algorithm with three lines of context.
+type DiffOptions struct {
+	Algorithm        string `json:"algorithm,omitempty"`  // "myers", "minimal", "patience" or "histogram"; empty for git's default
+	Whitespace       string `json:"whitespace,omitempty"` // WhitespaceAll, WhitespaceChange or empty
+	IgnoreBlankLines bool   `json:"ignoreBlankLines,omitempty"`
+	Context          *int   `json:"context,omitempty"` // lines of context around changes; nil means 3
+}
+
+// Validate reports the first option git would reject or that is out of range.
+func (o DiffOptions) Validate() error {
+	switch o.Algorithm {
+	case "", "myers", "minimal", "patience", "histogram":
+	default:
+		return fmt.Errorf("unknown diff algorithm %q", o.Algorithm)
+	}
+	switch o.Whitespace {
+	case "", WhitespaceAll, WhitespaceChange:
+	default:
+		return fmt.Errorf("unknown whitespace mode %q", o.Whitespace)
+	}
+	if n := o.context(); n < 0 || n > maxContext {
+		return fmt.Errorf("context must be between 0 and %d", maxContext)
+	}
+	return nil
+}
+
+// IgnoresWhitespace reports whether diffs made with o can differ from the
+// files' actual content, which rules out applying their hunks.
+func (o DiffOptions) IgnoresWhitespace() bool {
+	return o.Whitespace != "" || o.IgnoreBlankLines
+}
+
+// context returns the number of context lines o asks for.
+func (o DiffOptions) context() int {
+	if o.Context == nil {
+		return defaultContext
+	}
+	return *o.Context
+}
+
+// applyArgs returns args plus the git apply flags needed for hunks of diffs
+// made with o: without context lines, git apply must not expect any.
+func (o DiffOptions) applyArgs(args ...string) []string {
+	if o.context() == 0 {
+		return append(args, "--unidiff-zero")
+	}
+	return args
+}
+
+// args returns the git diff flags for o.
+func (o DiffOptions) args() []string {
+	// Fixed prefixes keep diff.noprefix and diff.mnemonicPrefix from
+	// changing the headers Parse and git apply read. Copies are detected
+	// among the files the diff modifies, as renames are by default.
+	args := []string{"--unified=" + strconv.Itoa(o.context()), "--src-prefix=" + srcPrefix, "--dst-prefix=" + dstPrefix, "--find-copies"}
+	if o.Algorithm != "" {
+		args = append(args, "--diff-algorithm="+o.Algorithm)
+	}
+	switch o.Whitespace {
+	case WhitespaceAll:
+		args = append(args, "--ignore-all-space")
+	case WhitespaceChange:
+		args = append(args, "--ignore-space-change")
+	}
+	if o.IgnoreBlankLines {
+		args = append(args, "--ignore-blank-lines")
+	}
+	return args
+}
@@ -0,0 +1,102 @@
+package git
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffOptionsWhitespace(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(20, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "twenty lines")
+	mustWrite(t, file, numberedLines(20, map[int]string{2: "  line 2", 18: "changed 18"}))
+
+	result, err := DiffInRepo(dir, DiffOptions{}, nil)
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	if hunks := result.Files[0].Hunks; len(hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d", len(hunks))
+	}
+
+	opts := DiffOptions{Whitespace: WhitespaceAll}
+	result, err = DiffInRepo(dir, opts, nil)
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	if hunks := result.Files[0].Hunks; len(hunks) != 1 || result.Files[0].Additions != 1 {
+		t.Fatalf("expected the reindent hidden, got %d hunks +%d", len(hunks), result.Files[0].Additions)
+	}
+
+	err = StageHunk(dir, HunkRef{Path: "tracked.txt", Index: 0, Options: opts})
+	if !errors.Is(err, ErrWhitespaceHunk) {
+		t.Fatalf("expected ErrWhitespaceHunk, got %v", err)
+	}
+	if staged := mustGit(t, dir, "diff", "--cached"); staged != "" {
+		t.Errorf("expected nothing staged, got:\n%s", staged)
+	}
+}
+
+func intPtr(n int) *int { return &n }
+
+func TestDiffOptionsContext(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(20, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "twenty lines")
+	mustWrite(t, file, numberedLines(20, map[int]string{2: "changed 2", 18: "changed 18"}))
+
+	// With enough context both changes fall into one hunk, which the hunk
+	// index and hash must then be resolved against.
+	opts := DiffOptions{Context: intPtr(20), Algorithm: "histogram"}
+	result, err := DiffInRepo(dir, opts, nil)
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	hunks := result.Files[0].Hunks
+	if len(hunks) != 1 {
+		t.Fatalf("expected 1 hunk, got %d", len(hunks))
+	}
+	if err := StageHunk(dir, HunkRef{Path: "tracked.txt", Index: 0, Hash: hunks[0].Hash, Options: opts}); err != nil {
+		t.Fatalf("StageHunk: %v", err)
+	}
+	if unstaged := mustGit(t, dir, "diff"); unstaged != "" {
+		t.Errorf("expected everything staged, got:\n%s", unstaged)
+	}
+
+	for _, bad := range []DiffOptions{{Algorithm: "--output=x"}, {Whitespace: "some"}, {Context: intPtr(-1)}, {Context: intPtr(maxContext + 1)}} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestDiffOptionsNoContext(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(20, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "twenty lines")
+	mustWrite(t, file, numberedLines(20, map[int]string{2: "changed 2", 18: "changed 18"}))
+
+	opts := DiffOptions{Context: intPtr(0)}
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	result, err := DiffInRepo(dir, opts, nil)
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	hunks := result.Files[0].Hunks
+	if len(hunks) != 2 || hunks[0].OldLines != 1 || len(hunks[0].Lines) != 2 {
+		t.Fatalf("expected 2 hunks without context, got %+v", hunks)
+	}
+	if err := StageHunk(dir, HunkRef{Path: "tracked.txt", Index: 1, Hash: hunks[1].Hash, Options: opts}); err != nil {
+		t.Fatalf("StageHunk: %v", err)
+	}
+	if staged := mustGit(t, dir, "diff", "--cached", "--unified=0"); !strings.Contains(staged, "+changed 18") || strings.Contains(staged, "changed 2\n") {
+		t.Errorf("expected only line 18 staged, got:\n%s", staged)
+	}
+}
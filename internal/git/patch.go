@@ -0,0 +1,282 @@
+package git
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrStaleHunk is returned when the hunk a client refers to no longer matches
+// the current diff, e.g. because the file was edited after the diff was loaded.
+var ErrStaleHunk = errors.New("hunk no longer matches the current diff — refresh and try again")
+
+// LineRange selects Hunk.Lines[From..To] (inclusive) within a hunk.
+type LineRange struct {
+	From int
+	To   int
+}
+
+// HunkRef identifies a hunk in a file's diff as the client last saw it.
+type HunkRef struct {
+	Path  string     // file path relative to the repository root
+	Index int        // position of the hunk within the file's diff
+	Hash  string     // the hunk's Hash as the client saw it; required
+	Lines *LineRange // optional: only these lines of the hunk
+
+	// Options are those of the diff the client saw, so that the hunk is
+	// looked up with the same algorithm and context size.
+	Options DiffOptions
+}
+
+// StageHunk applies a hunk of the working tree's unstaged diff to the index.
+func StageHunk(repoDir string, ref HunkRef) error {
+	patch, err := hunkPatch(repoDir, ref, false, false)
+	if err != nil {
+		return err
+	}
+	return applyPatch(repoDir, patch, ref.Options.applyArgs("--cached")...)
+}
+
+// UnstageHunk removes a hunk of the staged diff from the index.
+func UnstageHunk(repoDir string, ref HunkRef) error {
+	patch, err := hunkPatch(repoDir, ref, true, true)
+	if err != nil {
+		return err
+	}
+	return applyPatch(repoDir, patch, ref.Options.applyArgs("--cached", "--reverse")...)
+}
+
+// StageFile stages all changes to path, including an untracked file.
+func StageFile(repoDir, path string) error {
+	_, err := runGit(repoDir, "add", "-A", "--", topPathspec(path))
+	return err
+}
+
+// UnstageFile resets path in the index to HEAD, keeping the working tree.
+func UnstageFile(repoDir, path string) error {
+	_, err := runGit(repoDir, "reset", "-q", "--", topPathspec(path))
+	return err
+}
+
+// topPathspec makes path match relative to the repository root regardless
+// of which subdirectory git runs in.
+func topPathspec(path string) string {
+	return ":(top,literal)" + path
+}
+
+// applyPatch checks and then applies patch with git apply. --recount lets
+// git recompute hunk line counts, which change when only part of a hunk is
+// selected.
+func applyPatch(repoDir, patch string, args ...string) error {
+	base := append([]string{"apply", "--recount"}, args...)
+	check := append(append([]string{}, base...), "--check", "-")
+	if _, err := (gitCmd{dir: repoDir, stdin: patch, args: check}).run(); err != nil {
+		return fmt.Errorf("%w: %v", ErrStaleHunk, err)
+	}
+	_, err := gitCmd{dir: repoDir, stdin: patch, args: append(base, "-")}.run()
+	return err
+}
+
+// fileDiffRaw returns the current raw diff text of one file with opts: staged
+// (index vs HEAD) or unstaged (working tree vs index). An untracked file's
+// unstaged diff is synthesised as a new-file patch.
+func fileDiffRaw(repoDir, path string, staged bool, opts DiffOptions) (string, error) {
+	args := append([]string{"diff", "--no-color", "--no-ext-diff"}, opts.args()...)
+	if staged {
+		args = append(args, "--cached")
+	}
+	args = append(args, "--", topPathspec(path))
+	out, err := gitCmd{dir: repoDir, args: args}.run()
+	if err != nil {
+		return "", err
+	}
+	if out != "" || staged {
+		return out, nil
+	}
+
+	// Nothing tracked changed — the file may be untracked.
+	top, err := runGit(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	if untracked, _ := runGit(top, "ls-files", "--others", "--exclude-standard", "--", topPathspec(path)); untracked == "" {
+		return "", nil
+	}
+	var b strings.Builder
+	if _, err := writeUntrackedDiff(&b, top, path, hashUntracked(top, []string{path})[path]); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// hunkPatch builds a single-hunk patch for ref from the file's current staged
+// or unstaged diff. reverse indicates the patch will be applied with
+// --reverse, which changes how unselected lines are neutralised.
+func hunkPatch(repoDir string, ref HunkRef, staged, reverse bool) (string, error) {
+	if ref.Options.IgnoresWhitespace() {
+		return "", ErrWhitespaceHunk
+	}
+	raw, err := fileDiffRaw(repoDir, ref.Path, staged, ref.Options)
+	if err != nil {
+		return "", err
+	}
+	header, hunks := splitRawHunks(raw)
+	if ref.Index < 0 || ref.Index >= len(hunks) {
+		return "", ErrStaleHunk
+	}
+	hunk := hunks[ref.Index]
+	// Any edit to the hunk since the client loaded it, even one that keeps
+	// its line counts, must not be applied unseen.
+	if ref.Hash == "" || hunkHash(hunk) != ref.Hash {
+		return "", ErrStaleHunk
+	}
+	if ref.Lines != nil {
+		hunk, err = selectHunkLines(hunk, *ref.Lines, reverse)
+		if err != nil {
+			return "", err
+		}
+	}
+	return header + strings.Join(hunk, "\n") + "\n", nil
+}
+
+// hunkHash identifies a hunk by its "@@" line and its context, added and
+// deleted lines, given as raw diff lines. Other lines, such as "\ No newline
+// at end of file", are skipped, as Parse drops them.
+func hunkHash(lines []string) string {
+	h := sha1.New()
+	for _, l := range lines {
+		if l != "" && strings.IndexByte("@+- ", l[0]) >= 0 {
+			io.WriteString(h, l+"\n")
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// rawLines returns h as the raw diff lines hunkHash reads.
+func (h *Hunk) rawLines() []string {
+	lines := make([]string, 0, len(h.Lines)+1)
+	lines = append(lines, h.Header)
+	for _, l := range h.Lines {
+		prefix := " "
+		switch l.Type {
+		case "add":
+			prefix = "+"
+		case "del":
+			prefix = "-"
+		}
+		lines = append(lines, prefix+l.Content)
+	}
+	return lines
+}
+
+// splitRawHunks splits a single file's raw diff into its header (everything
+// before the first "@@" line, newline-terminated) and its hunks, each a slice
+// of lines starting with the "@@" line.
+func splitRawHunks(raw string) (string, [][]string) {
+	lines := strings.Split(strings.TrimSuffix(raw, "\n"), "\n")
+	var header strings.Builder
+	var hunks [][]string
+	for _, l := range lines {
+		if strings.HasPrefix(l, "@@") {
+			hunks = append(hunks, []string{l})
+			continue
+		}
+		if len(hunks) == 0 {
+			header.WriteString(l + "\n")
+			continue
+		}
+		hunks[len(hunks)-1] = append(hunks[len(hunks)-1], l)
+	}
+	return header.String(), hunks
+}
+
+// selectHunkLines keeps only the changes in sel (indices into the hunk's
+// content lines, as in Hunk.Lines) and neutralises the rest: an unselected
+// line that exists on the side the patch applies to becomes context, and one
+// that does not is dropped. Applied forwards that side is the old one (keep
+// "-" as context, drop "+"); applied in reverse it is the new one.
+// "\ No newline at end of file" markers follow the line they annotate.
+func selectHunkLines(hunk []string, sel LineRange, reverse bool) ([]string, error) {
+	keepAsContext, drop := byte('-'), byte('+')
+	if reverse {
+		keepAsContext, drop = '+', '-'
+	}
+
+	out := []string{hunk[0]}
+	idx := -1
+	changed := false
+	dropped := false
+	for _, l := range hunk[1:] {
+		if strings.HasPrefix(l, `\`) {
+			if !dropped {
+				out = append(out, l)
+			}
+			continue
+		}
+		idx++
+		dropped = false
+		if l == "" || l[0] == ' ' {
+			out = append(out, l)
+			continue
+		}
+		if idx >= sel.From && idx <= sel.To {
+			out = append(out, l)
+			changed = true
+			continue
+		}
+		switch l[0] {
+		case keepAsContext:
+			out = append(out, " "+l[1:])
+		case drop:
+			dropped = true
+		}
+	}
+	if !changed {
+		return nil, fmt.Errorf("no changed lines in range %d-%d", sel.From, sel.To)
+	}
+	return out, nil
+}
+
+// DiscardHunk reverts a hunk (or some of its lines) of the unstaged diff in
+// the working tree. The repo's dirty state is snapshotted first; the snapshot
+// is returned so the discard can be undone with RestoreSnapshotFile. Only the
+// newest maxDiscardSnapshots discard snapshots are kept.
+func DiscardHunk(repoDir string, ref HunkRef) (*Snapshot, error) {
+	patch, err := hunkPatch(repoDir, ref, false, true)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := snapshotForDiscard(repoDir, ref.Path)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	return snap, applyPatch(repoDir, patch, ref.Options.applyArgs("--reverse")...)
+}
+
+// DiscardFile reverts all unstaged changes to path, restoring it from the
+// index; an untracked file is deleted. The repo's dirty state is snapshotted
+// first, as for DiscardHunk.
+func DiscardFile(repoDir, path string) (*Snapshot, error) {
+	top, err := runGit(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := runGit(top, "ls-files", "--others", "--exclude-standard", "--", topPathspec(path))
+	if err != nil {
+		return nil, err
+	}
+	snap, err := snapshotForDiscard(repoDir, path)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	if untracked != "" {
+		return snap, os.Remove(filepath.Join(top, filepath.FromSlash(path)))
+	}
+	_, err = runGit(repoDir, "restore", "--worktree", "--", topPathspec(path))
+	return snap, err
+}
@@ -0,0 +1,212 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns "line 1\n" … "line n\n" with the given replacements.
+func numberedLines(n int, replace map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if r, ok := replace[i]; ok {
+			b.WriteString(r + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestStageUnstageHunk(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(20, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "twenty lines")
+	mustWrite(t, file, numberedLines(20, map[int]string{2: "changed 2", 18: "changed 18"}))
+
+	unstaged := Parse(mustGit(t, dir, "diff"))
+	hunks := unstaged.Files[0].Hunks
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d", len(hunks))
+	}
+
+	// A hash from another hunk, or none, is rejected.
+	for _, hash := range []string{hunks[0].Hash, ""} {
+		err := StageHunk(dir, HunkRef{Path: "tracked.txt", Index: 1, Hash: hash})
+		if !errors.Is(err, ErrStaleHunk) {
+			t.Fatalf("hash %q: expected ErrStaleHunk, got %v", hash, err)
+		}
+	}
+
+	if err := StageHunk(dir, HunkRef{Path: "tracked.txt", Index: 1, Hash: hunks[1].Hash}); err != nil {
+		t.Fatalf("StageHunk: %v", err)
+	}
+	staged := mustGit(t, dir, "diff", "--cached")
+	if !strings.Contains(staged, "+changed 18") || strings.Contains(staged, "changed 2") {
+		t.Errorf("expected only the second hunk staged:\n%s", staged)
+	}
+
+	stagedHunk := Parse(staged).Files[0].Hunks[0]
+	if err := UnstageHunk(dir, HunkRef{Path: "tracked.txt", Index: 0, Hash: stagedHunk.Hash}); err != nil {
+		t.Fatalf("UnstageHunk: %v", err)
+	}
+	if staged := mustGit(t, dir, "diff", "--cached"); staged != "" {
+		t.Errorf("expected nothing staged, got:\n%s", staged)
+	}
+}
+
+func TestStageHunkEditedSameShape(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(10, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "ten lines")
+	mustWrite(t, file, numberedLines(10, map[int]string{5: "reviewed"}))
+	hunk := Parse(mustGit(t, dir, "diff")).Files[0].Hunks[0]
+
+	// Same line counts and header, different content.
+	mustWrite(t, file, numberedLines(10, map[int]string{5: "not reviewed"}))
+	err := StageHunk(dir, HunkRef{Path: "tracked.txt", Index: 0, Hash: hunk.Hash})
+	if !errors.Is(err, ErrStaleHunk) {
+		t.Fatalf("expected ErrStaleHunk, got %v", err)
+	}
+	if staged := mustGit(t, dir, "diff", "--cached"); staged != "" {
+		t.Errorf("expected nothing staged, got:\n%s", staged)
+	}
+}
+
+func TestStageHunkLines(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(10, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "ten lines")
+	mustWrite(t, file, numberedLines(10, map[int]string{5: "five", 6: "six"}))
+
+	// Hunk lines: ctx 2-4, -5, -6, +five, +six, ctx 7-9. Select "-line 5" only.
+	hunk := Parse(mustGit(t, dir, "diff")).Files[0].Hunks[0]
+	if lines := hunk.Lines; lines[3].Type != "del" || lines[3].Content != "line 5" {
+		t.Fatalf("unexpected hunk layout: %+v", lines)
+	}
+	ref := HunkRef{Path: "tracked.txt", Index: 0, Hash: hunk.Hash, Lines: &LineRange{From: 3, To: 3}}
+	if err := StageHunk(dir, ref); err != nil {
+		t.Fatalf("StageHunk: %v", err)
+	}
+	want := numberedLines(10, map[int]string{})
+	want = strings.Replace(want, "line 5\n", "", 1)
+	if got := mustGit(t, dir, "show", ":tracked.txt"); got != want {
+		t.Errorf("index content:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Unstage it again by selecting the same deletion in the staged diff.
+	hunk = Parse(mustGit(t, dir, "diff", "--cached")).Files[0].Hunks[0]
+	ref = HunkRef{Path: "tracked.txt", Index: 0, Hash: hunk.Hash, Lines: &LineRange{From: 3, To: 3}}
+	if err := UnstageHunk(dir, ref); err != nil {
+		t.Fatalf("UnstageHunk: %v", err)
+	}
+	if staged := mustGit(t, dir, "diff", "--cached"); staged != "" {
+		t.Errorf("expected nothing staged, got:\n%s", staged)
+	}
+}
+
+func TestStageUntrackedFileHunk(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, "sub", "new.txt"), "a\nb\n")
+	result := &DiffResult{}
+	if err := AddUntracked(dir, result); err != nil {
+		t.Fatalf("AddUntracked: %v", err)
+	}
+	if err := StageHunk(dir, HunkRef{Path: "sub/new.txt", Index: 0, Hash: result.Files[0].Hunks[0].Hash}); err != nil {
+		t.Fatalf("StageHunk: %v", err)
+	}
+	if got := mustGit(t, dir, "show", ":sub/new.txt"); got != "a\nb\n" {
+		t.Errorf("index content: %q", got)
+	}
+}
+
+func TestDiscardHunkAndUndo(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(20, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "twenty lines")
+	edited := numberedLines(20, map[int]string{2: "two", 18: "eighteen"})
+	mustWrite(t, file, edited)
+
+	hunks := Parse(mustGit(t, dir, "diff")).Files[0].Hunks
+	snap, err := DiscardHunk(dir, HunkRef{Path: "tracked.txt", Index: 1, Hash: hunks[1].Hash})
+	if err != nil {
+		t.Fatalf("DiscardHunk: %v", err)
+	}
+	if snap == nil {
+		t.Fatal("expected a snapshot")
+	}
+	if got, want := readFile(t, file), numberedLines(20, map[int]string{2: "two"}); got != want {
+		t.Errorf("after discard:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := RestoreSnapshotFile(dir, snap.ID, "tracked.txt"); err != nil {
+		t.Fatalf("RestoreSnapshotFile: %v", err)
+	}
+	if got := readFile(t, file); got != edited {
+		t.Errorf("after undo:\n%s\nwant:\n%s", got, edited)
+	}
+}
+
+func TestDiscardUntrackedFile(t *testing.T) {
+	dir := newTestRepo(t)
+	path := filepath.Join(dir, "sub", "new.txt")
+	mustWrite(t, path, "a\nb\n")
+
+	snap, err := DiscardFile(dir, "sub/new.txt")
+	if err != nil {
+		t.Fatalf("DiscardFile: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected file removed, stat err = %v", err)
+	}
+	if err := RestoreSnapshotFile(dir, snap.ID, "sub/new.txt"); err != nil {
+		t.Fatalf("RestoreSnapshotFile: %v", err)
+	}
+	if got := readFile(t, path); got != "a\nb\n" {
+		t.Errorf("after undo: %q", got)
+	}
+}
+
+func TestDiscardSnapshotsPruned(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "dirty\n")
+	// Only where a snapshot is stored marks it as a discard's, not its message.
+	kept, err := SnapshotRepo(dir, "discard by hand")
+	if err != nil {
+		t.Fatalf("SnapshotRepo: %v", err)
+	}
+
+	var last *Snapshot
+	for i := 0; i < maxDiscardSnapshots+2; i++ {
+		name := fmt.Sprintf("new%d.txt", i)
+		mustWrite(t, filepath.Join(dir, name), "x\n")
+		if last, err = DiscardFile(dir, name); err != nil {
+			t.Fatalf("DiscardFile %s: %v", name, err)
+		}
+	}
+
+	snapshots, err := ListSnapshots(dir)
+	if err != nil {
+		t.Fatalf("ListSnapshots: %v", err)
+	}
+	if len(snapshots) != maxDiscardSnapshots+1 {
+		t.Fatalf("expected %d snapshots, got %d", maxDiscardSnapshots+1, len(snapshots))
+	}
+	if snapshots[0].ID != last.ID || !snapshots[0].Discard {
+		t.Errorf("expected the newest discard first, got %+v", snapshots[0])
+	}
+	if oldest := snapshots[len(snapshots)-1]; oldest.ID != kept.ID || oldest.Discard {
+		t.Errorf("expected the other snapshot kept, got %+v", oldest)
+	}
+	if err := RestoreSnapshotFile(dir, last.ID, fmt.Sprintf("new%d.txt", maxDiscardSnapshots+1)); err != nil {
+		t.Errorf("RestoreSnapshotFile from a discard snapshot: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Prefixes git diff is run with, regardless of diff.noprefix and
+// diff.mnemonicPrefix, so Parse, diff2html and git apply see the usual form.
+const (
+	srcPrefix = "a/"
+	dstPrefix = "b/"
+)
+
+// diffPrefixes are the path prefixes git may put on diff header names: a/ and
+// b/ by default, and c/ (commit), i/ (index), w/ (work tree) and o/ (object)
+// with diff.mnemonicPrefix.
+const diffPrefixes = "abciow"
+
+// unquotePath decodes a path git printed in C-style quotes, such as
+// "a/\303\251t\303\251.go" for a/été.go. Unquoted paths are returned as is.
+func unquotePath(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	// Git's escapes (\t, \n, \", \\, \a, \b, \f, \r, \v and three-digit
+	// octal bytes) are a subset of Go's.
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// quotePath quotes path as git does when it contains control characters,
+// double quotes or backslashes. Other bytes, including UTF-8, are left as is,
+// as with core.quotePath=false.
+func quotePath(path string) string {
+	if !strings.ContainsFunc(path, func(r rune) bool { return r < 0x20 || r == 0x7f || r == '"' || r == '\\' }) {
+		return path
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\%03o`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// headerName formats name for a ---/+++ line as git does, with a trailing
+// tab after names containing spaces.
+func headerName(name string) string {
+	q := quotePath(name)
+	if strings.Contains(q, " ") {
+		return q + "\t"
+	}
+	return q
+}
+
+// splitDiffGitLine returns the two names of a "diff --git" line, unquoted but
+// still prefixed. Unquoted names may contain spaces, so an unquoted pair is
+// split where it reads as one path twice (the common case of no rename);
+// otherwise at " b/". Callers prefer the ---/+++ and rename lines, which name
+// one path each, when the diff has them.
+func splitDiffGitLine(line string) (string, string) {
+	rest := strings.TrimPrefix(line, "diff --git ")
+	if strings.HasPrefix(rest, `"`) {
+		if end := closingQuote(rest); end > 0 && end+1 < len(rest) && rest[end+1] == ' ' {
+			return unquotePath(rest[:end+1]), unquotePath(rest[end+2:])
+		}
+	}
+	if i := strings.Index(rest, ` "`); i >= 0 && strings.HasSuffix(rest, `"`) {
+		return rest[:i], unquotePath(rest[i+1:])
+	}
+	if n := len(rest); n%2 == 1 && rest[n/2] == ' ' {
+		a, b := rest[:n/2], rest[n/2+1:]
+		if stripPrefix(a) == stripPrefix(b) {
+			return a, b
+		}
+	}
+	if i := strings.Index(rest, " "+dstPrefix); i >= 0 {
+		return rest[:i], rest[i+1:]
+	}
+	if a, b, ok := strings.Cut(rest, " "); ok {
+		return a, b
+	}
+	return rest, rest
+}
+
+// closingQuote returns the index of the quote ending the quoted string at
+// the start of s, or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// stripPrefix removes a one-letter diff prefix such as "a/" or "w/".
+func stripPrefix(name string) string {
+	if len(name) > 2 && name[1] == '/' && strings.IndexByte(diffPrefixes, name[0]) >= 0 {
+		return name[2:]
+	}
+	return name
+}
+
+// hasPrefixes reports whether the names of a "diff --git" line carry
+// prefixes, i.e. both start with one and the prefixes differ. Diffs made with
+// --no-prefix have none, and their names are equal unless renamed.
+func hasPrefixes(oldName, newName string) bool {
+	return stripPrefix(oldName) != oldName && stripPrefix(newName) != newName && oldName[0] != newName[0]
+}
+
+// headerPath returns the path named by a ---/+++ line's argument: unquoted,
+// without the trailing tab git adds after names containing spaces, and with
+// prefix removed. prefixed is false for diffs made with --no-prefix.
+func headerPath(arg string, prefixed bool) string {
+	name := unquotePath(strings.TrimSuffix(arg, "\t"))
+	if name == "/dev/null" || !prefixed {
+		return name
+	}
+	return stripPrefix(name)
+}
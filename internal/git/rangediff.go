@@ -0,0 +1,191 @@
+package git
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Values for RangeDiffCommit.Status.
+const (
+	RangeUnchanged = "unchanged" // same patch in both versions ("=")
+	RangeModified  = "modified"  // patch or message changed ("!")
+	RangeDropped   = "dropped"   // only in the old version ("<")
+	RangeAdded     = "added"     // only in the new version (">")
+)
+
+// maxTips caps how many reflog entries ListTips offers.
+const maxTips = 20
+
+// RangeDiff compares two versions of a branch, old and new, commit by commit
+// as `git range-diff` does. Both versions are taken relative to Base.
+type RangeDiff struct {
+	Base    string            `json:"base"`
+	Old     string            `json:"old"` // resolved commit hash
+	New     string            `json:"new"`
+	Commits []RangeDiffCommit `json:"commits"`
+}
+
+// RangeDiffCommit is one line of range-diff output: a commit pair, or a
+// commit present in only one version. Index fields are 1-based positions in
+// each version; 0 means the commit is absent there.
+type RangeDiffCommit struct {
+	Status    string `json:"status"`
+	OldIndex  int    `json:"oldIndex,omitempty"`
+	OldHash   string `json:"oldHash,omitempty"`
+	NewIndex  int    `json:"newIndex,omitempty"`
+	NewHash   string `json:"newHash,omitempty"`
+	Subject   string `json:"subject"`
+	Interdiff string `json:"interdiff,omitempty"` // diff of the two patches, for modified commits
+}
+
+// rangeDiffPairLine matches a range-diff commit line, e.g.
+// "3:  07cd012 ! 3:  a5bfab8 feat C" or "-:  ------- > 4:  36cc0b8 feat D".
+var rangeDiffPairLine = regexp.MustCompile(`^\s*(-|\d+):\s+(-+|[0-9a-f]+) ([=!<>])\s+(-|\d+):\s+(-+|[0-9a-f]+) (.*)$`)
+
+var rangeDiffStatus = map[string]string{
+	"=": RangeUnchanged,
+	"!": RangeModified,
+	"<": RangeDropped,
+	">": RangeAdded,
+}
+
+// DiffRange runs `git range-diff base old new` in repoDir: the commits of
+// base..old against those of base..new. A revision that does not name a
+// commit yields ErrInvalidRevision.
+func DiffRange(repoDir, base, old, new string) (*RangeDiff, error) {
+	baseHash, err := resolveCommit(repoDir, base)
+	if err != nil {
+		return nil, err
+	}
+	oldHash, err := resolveCommit(repoDir, old)
+	if err != nil {
+		return nil, err
+	}
+	newHash, err := resolveCommit(repoDir, new)
+	if err != nil {
+		return nil, err
+	}
+	out, err := gitCmd{dir: repoDir, args: []string{"range-diff", "--no-color", baseHash, oldHash, newHash}}.run()
+	if err != nil {
+		return nil, err
+	}
+	rd := ParseRangeDiff(out)
+	rd.Base, rd.Old, rd.New = base, oldHash, newHash
+	return rd, nil
+}
+
+// ParseRangeDiff parses the output of `git range-diff --no-color`. The
+// interdiff under a modified pair is kept as text with its indentation
+// removed; it is a diff of patches, not of files, so it is not run through
+// Parse.
+func ParseRangeDiff(raw string) *RangeDiff {
+	rd := &RangeDiff{Commits: []RangeDiffCommit{}}
+	var interdiff []string
+	flush := func() {
+		if n := len(rd.Commits); n > 0 && len(interdiff) > 0 {
+			rd.Commits[n-1].Interdiff = strings.Join(interdiff, "\n") + "\n"
+		}
+		interdiff = nil
+	}
+	for _, line := range strings.Split(strings.TrimRight(raw, "\n"), "\n") {
+		if m := rangeDiffPairLine.FindStringSubmatch(line); m != nil {
+			flush()
+			c := RangeDiffCommit{Status: rangeDiffStatus[m[3]], Subject: m[6]}
+			if m[1] != "-" {
+				c.OldIndex, _ = strconv.Atoi(m[1])
+				c.OldHash = m[2]
+			}
+			if m[4] != "-" {
+				c.NewIndex, _ = strconv.Atoi(m[4])
+				c.NewHash = m[5]
+			}
+			rd.Commits = append(rd.Commits, c)
+			continue
+		}
+		if len(rd.Commits) > 0 {
+			interdiff = append(interdiff, strings.TrimPrefix(line, "    "))
+		}
+	}
+	flush()
+	return rd
+}
+
+// Values for Tip.Kind.
+const (
+	TipReflog     = "reflog"
+	TipTag        = "tag"
+	TipCheckpoint = "checkpoint"
+)
+
+// Tip is an earlier version of a branch that DiffRange can compare against.
+type Tip struct {
+	Rev   string `json:"rev"` // what to pass to DiffRange as old
+	Kind  string `json:"kind"`
+	Hash  string `json:"hash"`
+	Label string `json:"label"`
+	Time  int64  `json:"time"` // unix timestamp
+}
+
+// ListTips returns candidate old versions of branch: its review checkpoint,
+// tags not merged into HEAD, and recent reflog entries, skipping HEAD itself
+// and repeated commits.
+func ListTips(repoDir, branch string) ([]Tip, error) {
+	head, err := runGit(repoDir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	tips := []Tip{}
+	seen := map[string]bool{head: true}
+	add := func(t Tip) {
+		if t.Hash == "" || seen[t.Hash] {
+			return
+		}
+		seen[t.Hash] = true
+		tips = append(tips, t)
+	}
+
+	// The checkpoint commit wraps a worktree tree; its parent is the branch
+	// tip at the time it was recorded.
+	if cp, err := LoadCheckpoint(repoDir, branch); err == nil {
+		if hash, err := runGit(repoDir, "rev-parse", "--verify", "-q", cp.Commit+"^"); err == nil {
+			add(Tip{Rev: hash, Kind: TipCheckpoint, Hash: hash, Label: "review checkpoint", Time: cp.Time})
+		}
+	}
+
+	out, err := runGit(repoDir, "for-each-ref", "--no-merged=HEAD", "--sort=-creatordate",
+		"--format=%(refname:short)%00%(objectname)%00%(*objectname)%00%(creatordate:unix)", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Split(line, "\x00")
+		if len(f) != 4 {
+			continue
+		}
+		hash := f[1]
+		if f[2] != "" {
+			hash = f[2] // annotated tag: the commit it points at
+		}
+		ts, _ := strconv.ParseInt(f[3], 10, 64)
+		add(Tip{Rev: "refs/tags/" + f[0], Kind: TipTag, Hash: hash, Label: f[0], Time: ts})
+	}
+
+	if branch == "" || branch == "HEAD" {
+		return tips, nil
+	}
+	out, err = runGit(repoDir, "reflog", "show", "-n", strconv.Itoa(maxTips),
+		"--format=%H%x00%gd%x00%gs%x00%ct", "refs/heads/"+branch, "--")
+	if err != nil {
+		return tips, nil // no reflog, e.g. core.logAllRefUpdates=false
+	}
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Split(line, "\x00")
+		if len(f) != 4 {
+			continue
+		}
+		ts, _ := strconv.ParseInt(f[3], 10, 64)
+		add(Tip{Rev: f[0], Kind: TipReflog, Hash: f[0], Label: f[1] + ": " + f[2], Time: ts})
+	}
+	return tips, nil
+}
@@ -0,0 +1,99 @@
+package git
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleRangeDiff = `1:  315d653 = 1:  9fe9e8b feat A
+2:  fe0b583 < -:  ------- feat B
+3:  07cd012 ! 2:  a5bfab8 feat C
+    @@ Metadata
+     Author: a <a@a>
+
+      ## Commit message ##
+    -    feat C
+    +    feat C v2
+-:  ------- > 3:  36cc0b8 feat D
+`
+
+func TestParseRangeDiff(t *testing.T) {
+	rd := ParseRangeDiff(sampleRangeDiff)
+	want := []RangeDiffCommit{
+		{Status: RangeUnchanged, OldIndex: 1, OldHash: "315d653", NewIndex: 1, NewHash: "9fe9e8b", Subject: "feat A"},
+		{Status: RangeDropped, OldIndex: 2, OldHash: "fe0b583", Subject: "feat B"},
+		{Status: RangeModified, OldIndex: 3, OldHash: "07cd012", NewIndex: 2, NewHash: "a5bfab8", Subject: "feat C"},
+		{Status: RangeAdded, NewIndex: 3, NewHash: "36cc0b8", Subject: "feat D"},
+	}
+	if len(rd.Commits) != len(want) {
+		t.Fatalf("expected %d commits, got %d", len(want), len(rd.Commits))
+	}
+	for i, w := range want {
+		got := rd.Commits[i]
+		got.Interdiff = ""
+		if got != w {
+			t.Errorf("commit %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if id := rd.Commits[2].Interdiff; !strings.HasPrefix(id, "@@ Metadata\n") || !strings.Contains(id, "\n+    feat C v2\n") {
+		t.Errorf("unexpected interdiff:\n%s", id)
+	}
+	if rd.Commits[0].Interdiff != "" || rd.Commits[3].Interdiff != "" {
+		t.Error("interdiff attached to an unmodified commit")
+	}
+}
+
+func TestDiffRangeAfterRebase(t *testing.T) {
+	dir := newTestRepo(t)
+	mustGit(t, dir, "checkout", "-q", "-b", "feature")
+	mustWrite(t, filepath.Join(dir, "a.txt"), "a\n")
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "add a")
+	mustWrite(t, filepath.Join(dir, "b.txt"), numberedLines(10, nil))
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "add b")
+	mustGit(t, dir, "tag", "v1")
+
+	// Upstream moves on; the branch is rebased and its last commit reworked.
+	mustGit(t, dir, "checkout", "-q", "main")
+	mustWrite(t, filepath.Join(dir, "upstream.txt"), "u\n")
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "upstream")
+	mustGit(t, dir, "checkout", "-q", "feature")
+	mustGit(t, dir, "rebase", "-q", "main")
+	mustWrite(t, filepath.Join(dir, "b.txt"), numberedLines(10, map[int]string{5: "b2"}))
+	mustGit(t, dir, "commit", "-q", "-a", "--amend", "--no-edit")
+
+	tips, err := ListTips(dir, "feature")
+	if err != nil {
+		t.Fatalf("ListTips: %v", err)
+	}
+	var rev string
+	for _, tip := range tips {
+		if tip.Kind == TipTag && tip.Label == "v1" {
+			rev = tip.Rev
+		}
+	}
+	if rev == "" {
+		t.Fatalf("tag v1 not offered: %+v", tips)
+	}
+
+	rd, err := DiffRange(dir, "main", rev, "HEAD")
+	if err != nil {
+		t.Fatalf("DiffRange: %v", err)
+	}
+	if len(rd.Commits) != 2 || rd.Commits[0].Status != RangeUnchanged || rd.Commits[1].Status != RangeModified {
+		t.Fatalf("unexpected range-diff %+v", rd.Commits)
+	}
+	if !strings.Contains(rd.Commits[1].Interdiff, "+b2") {
+		t.Errorf("interdiff misses the change:\n%s", rd.Commits[1].Interdiff)
+	}
+
+	for _, revs := range [][2]string{{"main", "--output=x"}, {"--output=x", rev}, {"no-such-base", rev}, {"main", "no-such-tip"}} {
+		if _, err := DiffRange(dir, revs[0], revs[1], "HEAD"); !errors.Is(err, ErrInvalidRevision) {
+			t.Errorf("DiffRange(%q, %q): expected ErrInvalidRevision, got %v", revs[0], revs[1], err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GitHubReview is the request body of GitHub's "create a review for a pull
+// request" API (POST /repos/{owner}/{repo}/pulls/{number}/reviews).
+type GitHubReview struct {
+	CommitID string                `json:"commit_id,omitempty"`
+	Body     string                `json:"body,omitempty"`
+	Event    string                `json:"event"`
+	Comments []GitHubReviewComment `json:"comments"`
+}
+
+// GitHubReviewComment is one line comment of a GitHubReview.
+type GitHubReviewComment struct {
+	Path string `json:"path"`
+	Side string `json:"side"` // "LEFT" (old) or "RIGHT" (new)
+	Line int    `json:"line"`
+	Body string `json:"body"`
+}
+
+// GitLabDiscussion is the request body of GitLab's "create a new merge
+// request thread" API (POST /projects/{id}/merge_requests/{iid}/discussions).
+// Each discussion is a separate call. Position is nil for a general note.
+type GitLabDiscussion struct {
+	Body     string          `json:"body"`
+	Position *GitLabPosition `json:"position,omitempty"`
+}
+
+// GitLabPosition anchors a GitLabDiscussion to a line. GitLab wants both line
+// numbers for an unchanged line and only one for an added or removed line.
+type GitLabPosition struct {
+	PositionType string `json:"position_type"`
+	BaseSHA      string `json:"base_sha"`
+	StartSHA     string `json:"start_sha"`
+	HeadSHA      string `json:"head_sha"`
+	OldPath      string `json:"old_path"`
+	NewPath      string `json:"new_path"`
+	OldLine      int    `json:"old_line,omitempty"`
+	NewLine      int    `json:"new_line,omitempty"`
+}
+
+// ReviewRefs are the commits a merge request diff is computed from: Base is
+// the merge base, Start the tip of the target branch and Head the source tip.
+type ReviewRefs struct {
+	Base  string `json:"base"`
+	Start string `json:"start"`
+	Head  string `json:"head"`
+}
+
+// ResolveReviewRefs returns the ReviewRefs of HEAD against base.
+func ResolveReviewRefs(repoDir, base string) (ReviewRefs, error) {
+	var refs ReviewRefs
+	var err error
+	if refs.Head, err = runGit(repoDir, "rev-parse", "HEAD"); err != nil {
+		return refs, err
+	}
+	if refs.Start, err = resolveCommit(repoDir, base); err != nil {
+		return refs, err
+	}
+	refs.Base, err = runGit(repoDir, "merge-base", refs.Start, refs.Head)
+	return refs, err
+}
+
+// ExportGitHub converts comments anchored by AnchorComments into a GitHub
+// review on commit head. Outdated comments cannot be placed on a line, so
+// they are listed in the review body instead.
+func ExportGitHub(comments []Comment, head string) GitHubReview {
+	review := GitHubReview{CommitID: head, Event: "COMMENT", Comments: []GitHubReviewComment{}}
+	var outdated []Comment
+	for _, c := range comments {
+		if c.Outdated {
+			outdated = append(outdated, c)
+			continue
+		}
+		side := "RIGHT"
+		if c.Side == SideOld {
+			side = "LEFT"
+		}
+		review.Comments = append(review.Comments, GitHubReviewComment{Path: c.Path, Side: side, Line: c.Line, Body: c.Body})
+	}
+	review.Body = outdatedSummary(outdated)
+	return review
+}
+
+// ExportGitLab converts comments anchored by AnchorComments against result
+// into GitLab merge request discussions. Outdated comments become general
+// notes naming their last known line.
+func ExportGitLab(result *DiffResult, comments []Comment, refs ReviewRefs) []GitLabDiscussion {
+	out := []GitLabDiscussion{}
+	for _, c := range comments {
+		if c.Outdated {
+			out = append(out, GitLabDiscussion{Body: fmt.Sprintf("`%s:%d`: %s", c.Path, c.Line, c.Body)})
+			continue
+		}
+		pos := &GitLabPosition{
+			PositionType: "text",
+			BaseSHA:      refs.Base,
+			StartSHA:     refs.Start,
+			HeadSHA:      refs.Head,
+			OldPath:      c.Path,
+			NewPath:      c.Path,
+		}
+		if f := findFile(result, c.Path); f != nil && (f.Status == "renamed" || f.Status == "copied") {
+			pos.OldPath, pos.NewPath = f.OldName, f.NewName
+		}
+		other := 0
+		lines := sideLines(result, c.Path, c.Side)
+		if i := lineIndex(lines, c.Line); i >= 0 {
+			other = lines[i].other
+		}
+		if c.Side == SideOld {
+			pos.OldLine, pos.NewLine = c.Line, other
+		} else {
+			pos.OldLine, pos.NewLine = other, c.Line
+		}
+		out = append(out, GitLabDiscussion{Body: c.Body, Position: pos})
+	}
+	return out
+}
+
+// ExportMarkdown renders comments as a Markdown checklist, one item per
+// comment, headed by branch.
+func ExportMarkdown(branch string, comments []Comment) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Review notes: %s\n\n", branchKey(branch))
+	if len(comments) == 0 {
+		b.WriteString("No comments.\n")
+		return b.String()
+	}
+	for _, c := range comments {
+		fmt.Fprintf(&b, "- [ ] `%s:%d`", c.Path, c.Line)
+		if c.Side == SideOld {
+			b.WriteString(" (old)")
+		}
+		if c.Outdated {
+			b.WriteString(" (outdated)")
+		}
+		b.WriteString(" — ")
+		b.WriteString(strings.ReplaceAll(c.Body, "\n", "\n  "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// outdatedSummary lists comments whose lines are no longer in the diff.
+func outdatedSummary(comments []Comment) string {
+	if len(comments) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Comments on lines no longer in the diff:\n")
+	for _, c := range comments {
+		fmt.Fprintf(&b, "\n- `%s:%d`: %s", c.Path, c.Line, c.Body)
+	}
+	return b.String()
+}
+
+// findFile returns the entry of result for path, matched by new name, else
+// by old name. A copy's source keeps its own entry, which names it as new.
+func findFile(result *DiffResult, path string) *FileDiff {
+	for i := range result.Files {
+		if filePath(result.Files[i]) == path {
+			return &result.Files[i]
+		}
+	}
+	for i := range result.Files {
+		if result.Files[i].OldName == path {
+			return &result.Files[i]
+		}
+	}
+	return nil
+}
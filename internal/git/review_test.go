@@ -0,0 +1,106 @@
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportReview(t *testing.T) {
+	dir := newTestRepo(t)
+	file := filepath.Join(dir, "tracked.txt")
+	mustWrite(t, file, numberedLines(10, nil))
+	mustGit(t, dir, "commit", "-q", "-am", "ten lines")
+	mustGit(t, dir, "checkout", "-q", "-b", "feature")
+	mustWrite(t, file, numberedLines(10, map[int]string{5: "new\nline 5"}))
+	mustGit(t, dir, "commit", "-q", "-am", "insert")
+
+	result := Parse(mustGit(t, dir, "diff", "main...HEAD"))
+	if _, err := AddComment(dir, "feature", result, "tracked.txt", SideNew, 5, "why?"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddComment(dir, "feature", result, "tracked.txt", SideNew, 7, "context\nnote"); err != nil {
+		t.Fatal(err)
+	}
+	comments, err := AnchorComments(dir, "feature", result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := ResolveReviewRefs(dir, "main")
+	if err != nil {
+		t.Fatalf("ResolveReviewRefs: %v", err)
+	}
+	if refs.Base != refs.Start || refs.Head == refs.Base {
+		t.Errorf("unexpected refs %+v", refs)
+	}
+
+	gh := ExportGitHub(comments, refs.Head)
+	if len(gh.Comments) != 2 || gh.Comments[0].Side != "RIGHT" || gh.Comments[0].Line != 5 || gh.CommitID != refs.Head {
+		t.Errorf("unexpected GitHub review %+v", gh)
+	}
+
+	gl := ExportGitLab(result, comments, refs)
+	if len(gl) != 2 {
+		t.Fatalf("expected 2 discussions, got %d", len(gl))
+	}
+	if p := gl[0].Position; p.OldLine != 0 || p.NewLine != 5 {
+		t.Errorf("added line position = %+v", p)
+	}
+	if p := gl[1].Position; p.OldLine != 6 || p.NewLine != 7 || p.HeadSHA != refs.Head {
+		t.Errorf("context line position = %+v", p)
+	}
+
+	md := ExportMarkdown("feature", comments)
+	if !strings.Contains(md, "- [ ] `tracked.txt:5` — why?") || !strings.Contains(md, "context\n  note") {
+		t.Errorf("unexpected Markdown:\n%s", md)
+	}
+}
+
+func TestExportGitLabCopiedFile(t *testing.T) {
+	dir := newTestRepo(t)
+	body := numberedLines(20, nil)
+	mustWrite(t, filepath.Join(dir, "src.txt"), body)
+	mustGit(t, dir, "add", "src.txt")
+	mustGit(t, dir, "commit", "-q", "-m", "src")
+	mustGit(t, dir, "checkout", "-q", "-b", "feature")
+	// The copy sorts before its source, which the diff also lists as modified.
+	mustWrite(t, filepath.Join(dir, "src.txt"), body+"line 21\n")
+	mustWrite(t, filepath.Join(dir, "a-copy.txt"), body+"copied\n")
+	mustGit(t, dir, "add", "-A")
+	mustGit(t, dir, "commit", "-q", "-m", "copy")
+
+	result, err := DiffInRepo(dir, DiffOptions{}, []string{"main...HEAD"})
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	if f := findFile(result, "a-copy.txt"); f == nil || f.Status != "copied" {
+		t.Fatalf("expected a-copy.txt copied, got %+v", f)
+	}
+	for _, path := range []string{"a-copy.txt", "src.txt"} {
+		if _, err := AddComment(dir, "feature", result, path, SideNew, 21, "note on "+path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	comments, err := AnchorComments(dir, "feature", result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, err := ResolveReviewRefs(dir, "main")
+	if err != nil {
+		t.Fatalf("ResolveReviewRefs: %v", err)
+	}
+
+	paths := make(map[string][2]string)
+	for _, d := range ExportGitLab(result, comments, refs) {
+		if d.Position == nil {
+			t.Fatalf("comment exported as outdated: %+v", d)
+		}
+		paths[d.Body] = [2]string{d.Position.OldPath, d.Position.NewPath}
+	}
+	if got := paths["note on a-copy.txt"]; got != [2]string{"src.txt", "a-copy.txt"} {
+		t.Errorf("copy position paths = %v", got)
+	}
+	if got := paths["note on src.txt"]; got != [2]string{"src.txt", "src.txt"} {
+		t.Errorf("source position paths = %v", got)
+	}
+}
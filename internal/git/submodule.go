@@ -0,0 +1,44 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// maxSubmoduleCommits caps the commits DescribeSubmodules lists per submodule.
+const maxSubmoduleCommits = 50
+
+// DescribeSubmodules fills in the commits between the old and new commit of
+// result's submodule changes, read from the submodules checked out in the
+// repository containing repoDir. It is best effort: submodules that are not
+// checked out or lack either commit are left without a log.
+func DescribeSubmodules(repoDir string, result *DiffResult) {
+	var top string
+	for i := range result.Files {
+		sub := result.Files[i].Submodule
+		if sub == nil || !IsCommitID(sub.OldCommit) || !IsCommitID(sub.NewCommit) || sub.OldCommit == sub.NewCommit {
+			continue
+		}
+		if top == "" {
+			var err error
+			if top, err = runGit(repoDir, "rev-parse", "--show-toplevel"); err != nil {
+				return
+			}
+		}
+		dir := filepath.Join(top, filepath.FromSlash(filePath(result.Files[i])))
+		// Without its own .git, git would run in the superproject.
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err != nil {
+			continue
+		}
+		out, err := runGit(dir, "log", "--reverse", "--no-color", commitLogFormat,
+			sub.OldCommit+".."+sub.NewCommit, "--")
+		if err != nil {
+			continue
+		}
+		sub.Commits = parseCommits(out)
+		if n := len(sub.Commits); n > maxSubmoduleCommits {
+			sub.Omitted = n - maxSubmoduleCommits
+			sub.Commits = sub.Commits[n-maxSubmoduleCommits:]
+		}
+	}
+}
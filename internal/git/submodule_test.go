@@ -0,0 +1,71 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDescribeSubmodules(t *testing.T) {
+	dir := newTestRepo(t)
+	sub := filepath.Join(dir, "lib")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mustGit(t, sub, "init", "-q", "-b", "main")
+	mustGit(t, sub, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "first")
+	mustGit(t, dir, "add", "lib")
+	mustGit(t, dir, "commit", "-q", "-m", "add lib")
+	for _, msg := range []string{"second", "third"} {
+		mustGit(t, sub, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", msg)
+	}
+
+	result, err := DiffInRepo(dir, DiffOptions{}, nil)
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	if len(result.Files) != 1 || result.Files[0].Submodule == nil {
+		t.Fatalf("expected one submodule change, got %+v", result.Files)
+	}
+	DescribeSubmodules(dir, result)
+	s := result.Files[0].Submodule
+	head := strings.TrimSpace(mustGit(t, sub, "rev-parse", "HEAD"))
+	if s.NewCommit != head || s.OldCommit == "" {
+		t.Errorf("commits: got %s..%s, want ..%s", s.OldCommit, s.NewCommit, head)
+	}
+	if len(s.Commits) != 2 || s.Commits[0].Subject != "second" || s.Commits[1].Subject != "third" {
+		t.Errorf("log: got %+v", s.Commits)
+	}
+}
+
+func TestDiffModeAndSymlink(t *testing.T) {
+	dir := newTestRepo(t)
+	if err := os.Symlink("tracked.txt", filepath.Join(dir, "link")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	mustGit(t, dir, "add", "link")
+	mustGit(t, dir, "commit", "-q", "-m", "link")
+	if err := os.Chmod(filepath.Join(dir, "tracked.txt"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "link"))
+	if err := os.Symlink("elsewhere", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := DiffInRepo(dir, DiffOptions{}, nil)
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	files := make(map[string]FileDiff)
+	for _, f := range result.Files {
+		files[f.NewName] = f
+	}
+	if f := files["tracked.txt"]; f.OldMode != "100644" || f.NewMode != "100755" {
+		t.Errorf("tracked.txt modes: got %q → %q", f.OldMode, f.NewMode)
+	}
+	if f := files["link"]; f.OldTarget != "tracked.txt" || f.NewTarget != "elsewhere" {
+		t.Errorf("link targets: got %q → %q", f.OldTarget, f.NewTarget)
+	}
+}
@@ -0,0 +1,350 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trashRefPrefix is the ref namespace holding snapshots taken before ClearRepo.
+// Refs outside refs/heads and refs/tags are not shown by `git branch` or pushed
+// by default, but keep their commits reachable so gc never collects them.
+const trashRefPrefix = "refs/prview/trash/"
+
+// discardRefPrefix is the part of the trash holding snapshots taken before
+// discarding a file or hunk, which are pruned to the newest
+// maxDiscardSnapshots. Other snapshots are kept until deleted.
+const discardRefPrefix = trashRefPrefix + "discard/"
+
+// maxDiscardSnapshots is how many discard snapshots are kept.
+const maxDiscardSnapshots = 20
+
+// snapshotIdent is the author/committer recorded on snapshot commits, so that
+// taking a snapshot works even when user.name/user.email are not configured.
+var snapshotIdent = []string{
+	"GIT_AUTHOR_NAME=prview", "GIT_AUTHOR_EMAIL=prview@localhost",
+	"GIT_COMMITTER_NAME=prview", "GIT_COMMITTER_EMAIL=prview@localhost",
+}
+
+// Snapshot is a recoverable record of a repo's dirty state.
+// The commit has the same shape as a `git stash -u` entry (worktree commit
+// with HEAD, index and untracked-files parents), so it can be inspected with
+// `git stash show` and restored with `git stash apply --index`. Before the
+// first commit an empty root commit takes HEAD's place.
+type Snapshot struct {
+	ID      string `json:"id"`
+	Ref     string `json:"ref"`
+	Commit  string `json:"commit"`
+	Time    int64  `json:"time"` // unix timestamp
+	Message string `json:"message"`
+	Discard bool   `json:"discard,omitempty"` // taken before a discard, under discardRefPrefix
+}
+
+// SnapshotRepo records tracked changes, the index and untracked (non-ignored)
+// files of repoDir under refs/prview/trash/<id>. reason (e.g. "clear") is
+// appended to the commit message. It returns nil if there is nothing to
+// record. The working tree and index are left untouched.
+func SnapshotRepo(repoDir, reason string) (*Snapshot, error) {
+	return snapshotRepo(repoDir, reason, trashRefPrefix)
+}
+
+// snapshotRepo does the work of SnapshotRepo, storing the snapshot under
+// prefix.
+func snapshotRepo(repoDir, reason, prefix string) (*Snapshot, error) {
+	// Work from the top level so untracked files outside a subdirectory
+	// launch point are included.
+	repoDir, err := runGit(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	status, err := runGit(repoDir, "status", "--porcelain", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	if status == "" {
+		return nil, nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "prview-snapshot-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	commitTree := func(tree, msg string, parents ...string) (string, error) {
+		args := []string{"commit-tree", tree, "-m", msg}
+		for _, p := range parents {
+			args = append(args, "-p", p)
+		}
+		out, err := gitCmd{dir: repoDir, env: snapshotIdent, args: args}.run()
+		return strings.TrimSpace(out), err
+	}
+
+	head, err := runGit(repoDir, "rev-parse", "--verify", "-q", "HEAD")
+	headSubject, _ := runGit(repoDir, "log", "-1", "--format=%h %s", "HEAD")
+	if err != nil {
+		// No commits yet: an empty root commit stands in for HEAD, keeping
+		// the snapshot's shape.
+		headSubject = "(no commits)"
+		emptyTree, err := gitCmd{dir: repoDir, args: []string{"mktree"}}.run()
+		if err != nil {
+			return nil, err
+		}
+		if head, err = commitTree(strings.TrimSpace(emptyTree), "empty base"); err != nil {
+			return nil, err
+		}
+	}
+	on := fmt.Sprintf("%s: %s", snapshotBranchLabel(repoDir), headSubject)
+
+	// Index.
+	indexTree, err := runGit(repoDir, "write-tree")
+	if err != nil {
+		return nil, err
+	}
+	indexCommit, err := commitTree(indexTree, "index on "+on, head)
+	if err != nil {
+		return nil, err
+	}
+	parents := []string{head, indexCommit}
+
+	// Untracked files, staged into a scratch index.
+	untracked, err := runGit(repoDir, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	if untracked != "" {
+		env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmpDir, "untracked")}
+		if _, err := (gitCmd{dir: repoDir, env: env, stdin: untracked, args: []string{"update-index", "--add", "-z", "--stdin"}}).run(); err != nil {
+			return nil, err
+		}
+		out, err := gitCmd{dir: repoDir, env: env, args: []string{"write-tree"}}.run()
+		if err != nil {
+			return nil, err
+		}
+		untrackedCommit, err := commitTree(strings.TrimSpace(out), "untracked files on "+on)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, untrackedCommit)
+	}
+
+	// Working tree: a copy of the index with all tracked modifications staged.
+	wtIndex := filepath.Join(tmpDir, "worktree")
+	if err := copyIndex(repoDir, wtIndex); err != nil {
+		return nil, err
+	}
+	env := []string{"GIT_INDEX_FILE=" + wtIndex}
+	if _, err := (gitCmd{dir: repoDir, env: env, args: []string{"add", "-u"}}).run(); err != nil {
+		return nil, err
+	}
+	out, err := gitCmd{dir: repoDir, env: env, args: []string{"write-tree"}}.run()
+	if err != nil {
+		return nil, err
+	}
+	msg := fmt.Sprintf("prview snapshot on %s (before %s)", on, reason)
+	wtCommit, err := commitTree(strings.TrimSpace(out), msg, parents...)
+	if err != nil {
+		return nil, err
+	}
+
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	ref := prefix + id
+	if _, err := runGit(repoDir, "update-ref", ref, wtCommit); err != nil {
+		return nil, err
+	}
+	return &Snapshot{ID: id, Ref: ref, Commit: wtCommit, Time: time.Now().Unix(), Message: msg, Discard: prefix == discardRefPrefix}, nil
+}
+
+// copyIndex copies repoDir's index to dst, for use as a scratch index that
+// starts out with the real one's entries and stat cache. A repository without
+// an index leaves dst absent, which git treats as empty.
+func copyIndex(repoDir, dst string) error {
+	indexPath, err := runGit(repoDir, "rev-parse", "--git-path", "index")
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(indexPath) {
+		indexPath = filepath.Join(repoDir, indexPath)
+	}
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil
+	}
+	return os.WriteFile(dst, data, 0o600)
+}
+
+// snapshotBranchLabel names HEAD the way git stash does: the branch name, or
+// "(no branch)" when detached.
+func snapshotBranchLabel(repoDir string) string {
+	b := gitBranch(repoDir)
+	if b == "" || b == "HEAD" {
+		return "(no branch)"
+	}
+	return b
+}
+
+// ListSnapshots returns the snapshots recorded in repoDir, newest first.
+func ListSnapshots(repoDir string) ([]Snapshot, error) {
+	out, err := runGit(repoDir, "for-each-ref",
+		"--format=%(refname)%00%(objectname)%00%(committerdate:unix)%00%(subject)", trashRefPrefix)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []Snapshot{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+		ts, _ := strconv.ParseInt(fields[2], 10, 64)
+		snapshots = append(snapshots, Snapshot{
+			ID:      path.Base(fields[0]),
+			Ref:     fields[0],
+			Commit:  fields[1],
+			Time:    ts,
+			Message: fields[3],
+			Discard: strings.HasPrefix(fields[0], discardRefPrefix),
+		})
+	}
+	// IDs are nanosecond timestamps of equal length, so they sort as strings.
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID > snapshots[j].ID })
+	return snapshots, nil
+}
+
+// RestoreSnapshot re-applies a snapshot's tracked changes, index and untracked
+// files on top of the current working tree. The snapshot is kept; it fails
+// without changing anything if restored files would overwrite local changes.
+func RestoreSnapshot(repoDir, id string) error {
+	ref, err := snapshotRef(repoDir, id)
+	if err != nil {
+		return err
+	}
+	if _, err := runGit(repoDir, "rev-parse", "--verify", "-q", "HEAD"); err != nil {
+		return restoreWithoutHead(repoDir, ref)
+	}
+	_, err = runGit(repoDir, "stash", "apply", "--index", ref)
+	return err
+}
+
+// restoreWithoutHead restores snapshot ref in a repository without commits,
+// where git stash apply has nothing to apply onto: the index is reset to the
+// snapshot's, and its working tree files and untracked files are written
+// back. Unlike stash apply, local changes to those files are overwritten.
+func restoreWithoutHead(repoDir, ref string) error {
+	top, err := runGit(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	if _, err := runGit(top, "read-tree", ref+"^2"); err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp("", "prview-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	trees := []string{ref}
+	if _, err := runGit(top, "rev-parse", "--verify", "-q", ref+"^3"); err == nil {
+		trees = append(trees, ref+"^3")
+	}
+	for i, tree := range trees {
+		// A scratch index checks the files out without touching the real one.
+		env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmpDir, strconv.Itoa(i))}
+		if _, err := (gitCmd{dir: top, env: env, args: []string{"read-tree", tree}}).run(); err != nil {
+			return err
+		}
+		if _, err := (gitCmd{dir: top, env: env, args: []string{"checkout-index", "-a", "-f"}}).run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreSnapshotFile restores one file's working-tree content from a
+// snapshot, leaving the index and every other file alone. This undoes a
+// single discard even when the rest of the tree has changed since. The whole
+// file is restored, even after discarding one hunk: edits made to the file
+// since the snapshot are overwritten.
+func RestoreSnapshotFile(repoDir, id, path string) error {
+	ref, err := snapshotRef(repoDir, id)
+	if err != nil {
+		return err
+	}
+	// Untracked files live in the snapshot's third parent.
+	source := ref
+	if _, err := runGit(repoDir, "cat-file", "-e", ref+"^3:"+path); err == nil {
+		source = ref + "^3"
+	}
+	_, err = runGit(repoDir, "restore", "--source="+source, "--worktree", "--", topPathspec(path))
+	return err
+}
+
+// snapshotForDiscard snapshots repoDir under discardRefPrefix before path is
+// discarded, as SnapshotRepo does, and prunes the oldest discard snapshots
+// beyond maxDiscardSnapshots.
+func snapshotForDiscard(repoDir, path string) (*Snapshot, error) {
+	snap, err := snapshotRepo(repoDir, "discard "+path, discardRefPrefix)
+	if err != nil || snap == nil {
+		return snap, err
+	}
+	snapshots, err := ListSnapshots(repoDir)
+	if err != nil {
+		return snap, nil // pruning is housekeeping; the snapshot is taken
+	}
+	kept := 0
+	for _, s := range snapshots {
+		if !s.Discard {
+			continue
+		}
+		if kept++; kept > maxDiscardSnapshots {
+			DeleteSnapshot(repoDir, s.ID)
+		}
+	}
+	return snap, nil
+}
+
+// DeleteSnapshot permanently removes a snapshot ref.
+func DeleteSnapshot(repoDir, id string) error {
+	ref, err := snapshotRef(repoDir, id)
+	if err != nil {
+		return err
+	}
+	_, err = runGit(repoDir, "update-ref", "-d", ref)
+	return err
+}
+
+// DeleteAllSnapshots removes every snapshot ref in repoDir.
+// Returns lists of deleted snapshot IDs and error messages.
+func DeleteAllSnapshots(repoDir string) ([]string, []string) {
+	snapshots, err := ListSnapshots(repoDir)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	var deleted, errs []string
+	for _, s := range snapshots {
+		if err := DeleteSnapshot(repoDir, s.ID); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", s.ID, err))
+		} else {
+			deleted = append(deleted, s.ID)
+		}
+	}
+	return deleted, errs
+}
+
+// snapshotRef validates id and returns its ref, failing if it does not exist.
+func snapshotRef(repoDir, id string) (string, error) {
+	if id == "" || strings.Trim(id, "0123456789") != "" {
+		return "", fmt.Errorf("invalid snapshot id %q", id)
+	}
+	for _, prefix := range []string{trashRefPrefix, discardRefPrefix} {
+		if _, err := runGit(repoDir, "rev-parse", "--verify", "-q", prefix+id); err == nil {
+			return prefix + id, nil
+		}
+	}
+	return "", fmt.Errorf("snapshot %q not found", id)
+}
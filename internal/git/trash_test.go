@@ -0,0 +1,147 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRepo creates a repo with one commit containing tracked.txt.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"config", "user.name", "test"},
+		{"config", "user.email", "test@example.com"},
+	} {
+		mustGit(t, dir, args...)
+	}
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "one\n")
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "initial")
+	return dir
+}
+
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %s", args, out)
+	}
+	return string(out)
+}
+
+func mustWrite(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestClearRepoSnapshotRestore(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, "staged.txt"), "staged\n")
+	mustGit(t, dir, "add", "staged.txt")
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "two\n")
+	mustWrite(t, filepath.Join(dir, "new", "untracked.txt"), "fresh\n")
+
+	snap, err := ClearRepo(dir)
+	if err != nil {
+		t.Fatalf("ClearRepo: %v", err)
+	}
+	if snap == nil {
+		t.Fatal("expected a snapshot of the dirty state")
+	}
+	if got := readFile(t, filepath.Join(dir, "tracked.txt")); got != "one\n" {
+		t.Errorf("tracked.txt not reset: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new", "untracked.txt")); !os.IsNotExist(err) {
+		t.Errorf("untracked file not cleaned")
+	}
+
+	list, err := ListSnapshots(dir)
+	if err != nil || len(list) != 1 || list[0].ID != snap.ID {
+		t.Fatalf("ListSnapshots: %v %+v", err, list)
+	}
+
+	if err := RestoreSnapshot(dir, snap.ID); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dir, "tracked.txt")); got != "two\n" {
+		t.Errorf("tracked.txt not restored: %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "new", "untracked.txt")); got != "fresh\n" {
+		t.Errorf("untracked.txt not restored: %q", got)
+	}
+	if staged := mustGit(t, dir, "diff", "--cached", "--name-only"); staged != "staged.txt\n" {
+		t.Errorf("index not restored: %q", staged)
+	}
+
+	if err := DeleteSnapshot(dir, snap.ID); err != nil {
+		t.Fatalf("DeleteSnapshot: %v", err)
+	}
+	if list, _ := ListSnapshots(dir); len(list) != 0 {
+		t.Errorf("expected no snapshots after delete, got %d", len(list))
+	}
+}
+
+func TestClearRepoCleanTakesNoSnapshot(t *testing.T) {
+	dir := newTestRepo(t)
+	snap, err := ClearRepo(dir)
+	if err != nil {
+		t.Fatalf("ClearRepo: %v", err)
+	}
+	if snap != nil {
+		t.Errorf("expected no snapshot for a clean repo, got %+v", snap)
+	}
+}
+
+func TestClearRepoWithoutCommits(t *testing.T) {
+	dir := t.TempDir()
+	mustGit(t, dir, "init", "-q", "-b", "main")
+	mustWrite(t, filepath.Join(dir, "staged.txt"), "staged\n")
+	mustGit(t, dir, "add", "staged.txt")
+	mustWrite(t, filepath.Join(dir, "staged.txt"), "edited\n")
+	mustWrite(t, filepath.Join(dir, "untracked.txt"), "untracked\n")
+
+	snap, err := ClearRepo(dir)
+	if err != nil {
+		t.Fatalf("ClearRepo: %v", err)
+	}
+	if snap == nil {
+		t.Fatal("expected a snapshot")
+	}
+	if got := readFile(t, filepath.Join(dir, "staged.txt")); got != "staged\n" {
+		t.Errorf("staged.txt after clear: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "untracked.txt")); !os.IsNotExist(err) {
+		t.Error("untracked.txt survived the clear")
+	}
+
+	if err := RestoreSnapshot(dir, snap.ID); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	if got := readFile(t, filepath.Join(dir, "staged.txt")); got != "edited\n" {
+		t.Errorf("staged.txt after restore: %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "untracked.txt")); got != "untracked\n" {
+		t.Errorf("untracked.txt after restore: %q", got)
+	}
+	if staged := mustGit(t, dir, "diff", "--cached", "--name-only"); staged != "staged.txt\n" {
+		t.Errorf("index after restore: %q", staged)
+	}
+}
@@ -0,0 +1,195 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Limits for synthesising diffs of untracked files.
+const (
+	// maxUntrackedFileSize is the largest untracked file whose content is
+	// included; larger files are listed with TooLarge set and no hunks.
+	maxUntrackedFileSize = 1 << 20
+	// maxUntrackedFiles caps how many untracked files are listed, so an
+	// unignored build directory does not swamp the response.
+	maxUntrackedFiles = 500
+	// binarySniffLen is how much of a file is checked for NUL bytes,
+	// matching git's own binary heuristic.
+	binarySniffLen = 8000
+)
+
+// AddUntracked appends untracked, non-ignored files in the repository
+// containing repoDir to result as "added" files marked Untracked, and
+// extends result.RawDiff with equivalent `new file` diff text.
+// If repoDir is empty, git runs in the current working directory.
+func AddUntracked(repoDir string, result *DiffResult) error {
+	top, err := runGit(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	out, err := runGit(top, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		return nil
+	}
+	paths := strings.Split(strings.TrimRight(out, "\x00"), "\x00")
+	if len(paths) > maxUntrackedFiles {
+		result.UntrackedOmitted = len(paths) - maxUntrackedFiles
+		paths = paths[:maxUntrackedFiles]
+	}
+
+	var raw strings.Builder
+	tooLarge := make(map[string]bool)
+	blobs := hashUntracked(top, paths)
+	for _, p := range paths {
+		large, err := writeUntrackedDiff(&raw, top, p, blobs[p])
+		if err != nil {
+			continue // vanished or unreadable since ls-files ran
+		}
+		if large {
+			tooLarge[p] = true
+		}
+	}
+
+	synth := Parse(raw.String())
+	for i := range synth.Files {
+		synth.Files[i].Untracked = true
+		synth.Files[i].TooLarge = tooLarge[synth.Files[i].NewName]
+	}
+	result.Files = append(result.Files, synth.Files...)
+	result.Additions += synth.Additions
+	result.RawDiff += raw.String()
+	return nil
+}
+
+// writeUntrackedDiff writes the diff git would show for adding path, whose
+// object ID is blob, and reports whether the content was omitted for
+// exceeding the size cap.
+func writeUntrackedDiff(b *strings.Builder, top, path, blob string) (bool, error) {
+	full := filepath.Join(top, filepath.FromSlash(path))
+	info, err := os.Lstat(full)
+	if err != nil {
+		return false, err
+	}
+	if blob == "" {
+		return false, fmt.Errorf("%s: could not hash", path)
+	}
+
+	mode := "100644"
+	var content []byte
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		mode = "120000"
+		target, err := os.Readlink(full)
+		if err != nil {
+			return false, err
+		}
+		content = []byte(target)
+	case !info.Mode().IsRegular():
+		return false, fmt.Errorf("%s: not a regular file", path)
+	default:
+		if info.Mode()&0o111 != 0 {
+			mode = "100755"
+		}
+		if info.Size() > maxUntrackedFileSize {
+			fmt.Fprintf(b, "diff --git %s %s\nnew file mode %s\nindex %s..%s\n", quotePath(srcPrefix+path), quotePath(dstPrefix+path), mode, nullBlob, blob)
+			return true, nil
+		}
+		if content, err = os.ReadFile(full); err != nil {
+			return false, err
+		}
+	}
+
+	fmt.Fprintf(b, "diff --git %s %s\nnew file mode %s\nindex %s..%s\n", quotePath(srcPrefix+path), quotePath(dstPrefix+path), mode, nullBlob, blob)
+	if len(content) == 0 {
+		return false, nil
+	}
+	if isBinary(content) {
+		fmt.Fprintf(b, "Binary files /dev/null and %s differ\n", quotePath(dstPrefix+path))
+		return false, nil
+	}
+
+	text := string(content)
+	noEOL := !strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	fmt.Fprintf(b, "--- /dev/null\n+++ %s\n", headerName(dstPrefix+path))
+	if len(lines) == 1 {
+		b.WriteString("@@ -0,0 +1 @@\n")
+	} else {
+		fmt.Fprintf(b, "@@ -0,0 +1,%d @@\n", len(lines))
+	}
+	for _, l := range lines {
+		b.WriteString("+" + l + "\n")
+	}
+	if noEOL {
+		b.WriteString("\\ No newline at end of file\n")
+	}
+	return false, nil
+}
+
+// nullBlob is the abbreviated all-zero hash git prints for a missing side.
+const nullBlob = "0000000"
+
+// hashUntracked returns the object IDs git add would give each of paths,
+// relative to top, keyed by path. Regular files are hashed in one git
+// hash-object run, so the repository's object format and clean filters apply;
+// symlinks hash their target. Paths that cannot be hashed are left out.
+func hashUntracked(top string, paths []string) map[string]string {
+	blobs := make(map[string]string, len(paths))
+	var files []string
+	for _, p := range paths {
+		full := filepath.Join(top, filepath.FromSlash(p))
+		info, err := os.Lstat(full)
+		switch {
+		case err != nil:
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(full)
+			if err != nil {
+				continue
+			}
+			if out, err := (gitCmd{dir: top, stdin: target, args: []string{"hash-object", "--stdin"}}).run(); err == nil {
+				blobs[p] = strings.TrimSpace(out)
+			}
+		case strings.Contains(p, "\n"):
+			// --stdin-paths reads one path per line.
+			if out, err := runGit(top, "hash-object", "--", p); err == nil {
+				blobs[p] = out
+			}
+		case info.Mode().IsRegular():
+			files = append(files, p)
+		}
+	}
+	if len(files) == 0 {
+		return blobs
+	}
+	out, err := gitCmd{dir: top, stdin: strings.Join(files, "\n") + "\n", args: []string{"hash-object", "--stdin-paths"}}.run()
+	if err != nil {
+		// A file vanished since ls-files ran, which stops the batch.
+		for _, p := range files {
+			if id, err := runGit(top, "hash-object", "--", p); err == nil {
+				blobs[p] = id
+			}
+		}
+		return blobs
+	}
+	for i, id := range strings.Fields(out) {
+		if i < len(files) {
+			blobs[files[i]] = id
+		}
+	}
+	return blobs
+}
+
+// isBinary reports whether data looks binary using git's heuristic:
+// a NUL byte within the first few kilobytes.
+func isBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
@@ -0,0 +1,116 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddUntracked(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, ".gitignore"), "*.log\n")
+	mustWrite(t, filepath.Join(dir, "pkg", "new.go"), "package pkg\n\nfunc New() {}")
+	mustWrite(t, filepath.Join(dir, "blob.bin"), "a\x00b")
+	mustWrite(t, filepath.Join(dir, "big.txt"), strings.Repeat("x", maxUntrackedFileSize+1))
+	mustWrite(t, filepath.Join(dir, "debug.log"), "ignored\n")
+
+	result := &DiffResult{}
+	if err := AddUntracked(dir, result); err != nil {
+		t.Fatalf("AddUntracked: %v", err)
+	}
+
+	files := make(map[string]FileDiff)
+	for _, f := range result.Files {
+		files[f.NewName] = f
+	}
+	if len(files) != 4 {
+		t.Fatalf("expected 4 untracked files (.gitignore, new.go, blob.bin, big.txt), got %v", result.Files)
+	}
+	if _, ok := files["debug.log"]; ok {
+		t.Error("ignored file listed")
+	}
+
+	f := files["pkg/new.go"]
+	if !f.Untracked || f.Status != "added" || f.Additions != 3 {
+		t.Errorf("pkg/new.go: got %+v", f)
+	}
+	if !files["blob.bin"].IsBinary {
+		t.Error("blob.bin: expected binary")
+	}
+	if big := files["big.txt"]; !big.TooLarge || len(big.Hunks) != 0 {
+		t.Errorf("big.txt: expected TooLarge with no hunks, got %+v", big)
+	}
+	if result.Additions != 4 { // 3 lines of new.go + 1 of .gitignore
+		t.Errorf("expected 4 additions, got %d", result.Additions)
+	}
+	if !strings.Contains(result.RawDiff, "+++ b/pkg/new.go") ||
+		!strings.Contains(result.RawDiff, "\\ No newline at end of file") {
+		t.Errorf("raw diff missing synthesised patch:\n%s", result.RawDiff)
+	}
+}
+
+func TestDiffPathsRoundTrip(t *testing.T) {
+	dir := newTestRepo(t)
+	names := []string{"my file.go", "x b/y.go", "été.go", "tab\there.go", `say "hi".go`}
+	for _, name := range names {
+		mustWrite(t, filepath.Join(dir, name), "one\n")
+	}
+	mustGit(t, dir, "add", ".")
+	mustGit(t, dir, "commit", "-q", "-m", "add")
+	for _, name := range names {
+		mustWrite(t, filepath.Join(dir, name), "two\n")
+	}
+	mustWrite(t, filepath.Join(dir, "new file.go"), "new\n")
+	// Header prefixes are fixed, whatever the user's configuration.
+	mustGit(t, dir, "config", "diff.noprefix", "true")
+	mustGit(t, dir, "config", "diff.mnemonicPrefix", "true")
+
+	result, err := DiffInRepo(dir, DiffOptions{}, nil)
+	if err != nil {
+		t.Fatalf("DiffInRepo: %v", err)
+	}
+	if err := AddUntracked(dir, result); err != nil {
+		t.Fatalf("AddUntracked: %v", err)
+	}
+	got := make(map[string]bool)
+	for _, f := range result.Files {
+		if f.Status != "added" && f.OldName != f.NewName {
+			t.Errorf("names differ: %q → %q", f.OldName, f.NewName)
+		}
+		got[f.NewName] = true
+	}
+	for _, name := range append(names, "new file.go") {
+		if !got[name] {
+			t.Errorf("%q missing from %v", name, got)
+		}
+	}
+}
+
+func TestAddUntrackedObjectIDs(t *testing.T) {
+	dir := newTestRepo(t)
+	// The text attribute makes git add store crlf.txt with LF endings, so
+	// its object ID is not the hash of the bytes on disk.
+	mustWrite(t, filepath.Join(dir, ".gitattributes"), "*.txt text\n")
+	mustWrite(t, filepath.Join(dir, "crlf.txt"), "one\r\ntwo\r\n")
+	if err := os.Symlink("crlf.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	result := &DiffResult{}
+	if err := AddUntracked(dir, result); err != nil {
+		t.Fatalf("AddUntracked: %v", err)
+	}
+	if len(result.Files) != 3 {
+		t.Fatalf("expected 3 untracked files, got %+v", result.Files)
+	}
+
+	// Compare with what git add records.
+	mustGit(t, dir, "add", "-A")
+	for _, path := range []string{".gitattributes", "crlf.txt", "link"} {
+		id := strings.Fields(mustGit(t, dir, "ls-files", "-s", "--", path))[1]
+		if want := "index " + nullBlob + ".." + id + "\n"; !strings.Contains(result.RawDiff, want) {
+			t.Errorf("%s: raw diff lacks %q:\n%s", path, want, result.RawDiff)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// viewedMu serialises read-modify-write cycles on viewed-state files.
+var viewedMu sync.Mutex
+
+// viewedFile returns the file holding the viewed state of the diff named by
+// key (its mode and base/ref). It lives in the worktree's own git dir, since
+// two worktrees of one repository show different changes.
+func viewedFile(repoDir, key string) (string, error) {
+	gitDir, err := runGit(repoDir, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, "prview", "viewed", url.PathEscape(key)+".json"), nil
+}
+
+// viewedKey names a file entry in the viewed state. In layers mode the same
+// path appears once per layer, and each is marked separately.
+func viewedKey(f FileDiff) string {
+	if f.Layer != "" {
+		return f.Layer + ":" + filePath(f)
+	}
+	return filePath(f)
+}
+
+// blobPair identifies the content on both sides of a file's diff. It changes
+// whenever either side's content does.
+func blobPair(f FileDiff) string {
+	return f.OldBlob + ".." + f.NewBlob
+}
+
+// loadViewed reads a viewed-state file: file key to the blobPair it was
+// marked viewed at.
+func loadViewed(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	viewed := map[string]string{}
+	if err := json.Unmarshal(data, &viewed); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return viewed, nil
+}
+
+func saveViewed(file string, viewed map[string]string) error {
+	if len(viewed) == 0 {
+		err := os.Remove(file)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(viewed, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// ApplyViewed sets Viewed on the files of result that were marked viewed in
+// the diff named by key and have not changed since, and fills in the
+// ViewedFiles and TotalFiles counts. Marks on files whose content changed
+// are dropped, so the file stays unviewed once it changes back.
+func ApplyViewed(repoDir, key string, result *DiffResult) error {
+	result.TotalFiles = len(result.Files)
+	file, err := viewedFile(repoDir, key)
+	if err != nil {
+		return err
+	}
+	viewedMu.Lock()
+	defer viewedMu.Unlock()
+	viewed, err := loadViewed(file)
+	if err != nil || len(viewed) == 0 {
+		return err
+	}
+
+	changed := false
+	for i := range result.Files {
+		f := &result.Files[i]
+		pair, ok := viewed[viewedKey(*f)]
+		if !ok {
+			continue
+		}
+		if pair != blobPair(*f) {
+			delete(viewed, viewedKey(*f))
+			changed = true
+			continue
+		}
+		f.Viewed = true
+		result.ViewedFiles++
+	}
+	if changed {
+		return saveViewed(file, viewed)
+	}
+	return nil
+}
+
+// SetViewed marks or unmarks path (in layer, for layers mode) as viewed in
+// the diff named by key. result must be that diff: a mark records the
+// file's current content and lapses when it changes.
+func SetViewed(repoDir, key string, result *DiffResult, path, layer string, mark bool) error {
+	target := result.File(path, layer)
+	if target == nil {
+		return fmt.Errorf("%s is not in the diff", path)
+	}
+
+	file, err := viewedFile(repoDir, key)
+	if err != nil {
+		return err
+	}
+	viewedMu.Lock()
+	defer viewedMu.Unlock()
+	viewed, err := loadViewed(file)
+	if err != nil {
+		return err
+	}
+	if mark {
+		viewed[viewedKey(*target)] = blobPair(*target)
+	} else {
+		delete(viewed, viewedKey(*target))
+	}
+	return saveViewed(file, viewed)
+}
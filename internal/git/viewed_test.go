@@ -0,0 +1,67 @@
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestViewedInvalidatedOnChange(t *testing.T) {
+	dir := newTestRepo(t)
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "two\n")
+	mustWrite(t, filepath.Join(dir, "new.txt"), "fresh\n")
+
+	diff := func() *DiffResult {
+		result := Parse(mustGit(t, dir, "diff"))
+		if err := AddUntracked(dir, result); err != nil {
+			t.Fatal(err)
+		}
+		if err := ApplyViewed(dir, "uncommitted", result); err != nil {
+			t.Fatalf("ApplyViewed: %v", err)
+		}
+		return result
+	}
+
+	result := diff()
+	if result.TotalFiles != 2 || result.ViewedFiles != 0 {
+		t.Fatalf("counts = %d/%d", result.ViewedFiles, result.TotalFiles)
+	}
+	if want := strings.TrimSpace(mustGit(t, dir, "hash-object", "new.txt")); result.Files[1].NewBlob != want {
+		t.Errorf("untracked blob = %q, want %q", result.Files[1].NewBlob, want)
+	}
+	for _, path := range []string{"tracked.txt", "new.txt"} {
+		if err := SetViewed(dir, "uncommitted", result, path, "", true); err != nil {
+			t.Fatalf("SetViewed %s: %v", path, err)
+		}
+	}
+	if err := SetViewed(dir, "uncommitted", result, "missing.txt", "", true); err == nil {
+		t.Error("expected an error for a file outside the diff")
+	}
+	if result = diff(); result.ViewedFiles != 2 {
+		t.Fatalf("expected 2 viewed, got %d", result.ViewedFiles)
+	}
+
+	// Another diff of the same repo keeps its own state.
+	other := Parse(mustGit(t, dir, "diff"))
+	if err := ApplyViewed(dir, "all main", other); err != nil || other.ViewedFiles != 0 {
+		t.Errorf("viewed state leaked across diffs: %v %d", err, other.ViewedFiles)
+	}
+
+	// Editing a viewed file unmarks it, and it stays unmarked if reverted.
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "three\n")
+	result = diff()
+	if result.ViewedFiles != 1 || result.Files[0].Viewed || !result.Files[1].Viewed {
+		t.Fatalf("expected only new.txt viewed, got %+v", result.Files)
+	}
+	mustWrite(t, filepath.Join(dir, "tracked.txt"), "two\n")
+	if result = diff(); result.Files[0].Viewed {
+		t.Error("reverted file should stay unviewed")
+	}
+
+	if err := SetViewed(dir, "uncommitted", result, "new.txt", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if result = diff(); result.ViewedFiles != 0 {
+		t.Errorf("expected nothing viewed, got %d", result.ViewedFiles)
+	}
+}
@@ -205,16 +205,40 @@ func DefaultBranch(repoDir string) string {
 
 // ClearRepo resets all changes in a repo (git checkout . + git clean -fd).
 // It also resets submodules recursively so nested dirty state is cleared.
-func ClearRepo(repoDir string) error {
-	if out, err := exec.Command("git", "-C", repoDir, "checkout", ".").CombinedOutput(); err != nil {
+// Before discarding anything, the dirty state of the repo and of each submodule
+// is recorded with SnapshotRepo; if that fails nothing is discarded. The
+// returned snapshot is the top-level one (nil if the repo itself was clean).
+func ClearRepo(repoDir string) (*Snapshot, error) {
+	snap, err := SnapshotRepo(repoDir, "clear")
+	if err != nil {
+		return nil, fmt.Errorf("snapshot: %w", err)
+	}
+	if err := discardAll(repoDir); err != nil {
+		return snap, err
+	}
+
+	// Reset submodules recursively — ignore errors (repo may have no submodules).
+	out, _ := runGit(repoDir, "submodule", "foreach", "--recursive", "--quiet", "pwd")
+	for _, sub := range strings.Split(out, "\n") {
+		if sub == "" {
+			continue
+		}
+		if _, err := SnapshotRepo(sub, "clear"); err != nil {
+			continue // leave a submodule we could not snapshot untouched
+		}
+		_ = discardAll(sub)
+	}
+	return snap, nil
+}
+
+// discardAll runs git checkout . and git clean -fd in dir.
+func discardAll(dir string) error {
+	if out, err := exec.Command("git", "-C", dir, "checkout", ".").CombinedOutput(); err != nil {
 		return fmt.Errorf("checkout: %s", strings.TrimSpace(string(out)))
 	}
-	if out, err := exec.Command("git", "-C", repoDir, "clean", "-fd").CombinedOutput(); err != nil {
+	if out, err := exec.Command("git", "-C", dir, "clean", "-fd").CombinedOutput(); err != nil {
 		return fmt.Errorf("clean: %s", strings.TrimSpace(string(out)))
 	}
-	// Reset submodules recursively — ignore errors (repo may have no submodules).
-	_ = exec.Command("git", "-C", repoDir, "submodule", "foreach", "--recursive",
-		"git checkout . && git clean -fd").Run()
 	return nil
 }
 
@@ -312,9 +336,9 @@ func DeleteAllWorktrees(repoDir string) ([]string, []string) {
 	return deleted, errs
 }
 
-// DiffInRepo runs git diff in a specific repository directory.
-func DiffInRepo(repoDir string, args []string) (*DiffResult, error) {
-	cmdArgs := append([]string{"-C", repoDir, "diff", "--unified=3", "--no-color"}, args...)
+// DiffInRepo runs git diff with opts in a specific repository directory.
+func DiffInRepo(repoDir string, opts DiffOptions, args []string) (*DiffResult, error) {
+	cmdArgs := append(append([]string{"-C", repoDir, "diff", "--no-color"}, opts.args()...), args...)
 	cmd := exec.Command("git", cmdArgs...)
 	out, err := cmd.Output()
 	if err != nil {
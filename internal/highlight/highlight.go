@@ -0,0 +1,224 @@
+// Package highlight tokenises source files for syntax highlighting. It knows
+// a small set of languages well enough to colour keywords, types, strings,
+// comments and numbers, and keeps lexer state across lines so that
+// multi-line strings and block comments are coloured correctly.
+package highlight
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Values for Token.Class.
+const (
+	Keyword = "keyword"
+	Type    = "type" // built-in types, constants and functions
+	String  = "string"
+	Comment = "comment"
+	Number  = "number"
+)
+
+// Token marks a highlighted region of a line as a half-open [Start, End)
+// byte range. Text outside tokens is plain.
+type Token struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Class string `json:"class"`
+}
+
+// Tokenize highlights content as language lang (a name returned by Detect or
+// Lookup) and returns the tokens of each line. Lines are split as git does:
+// a final newline does not start another line. It returns nil for an
+// unknown language.
+func Tokenize(lang, content string) [][]Token {
+	l := languages[lang]
+	if l == nil {
+		return nil
+	}
+	lx := &lexer{lang: l, src: content}
+	lx.run()
+	if content == "" || strings.HasSuffix(content, "\n") {
+		return lx.lines[:len(lx.lines)-1]
+	}
+	return lx.lines
+}
+
+// lexer scans a whole file, emitting tokens per line.
+type lexer struct {
+	lang      *language
+	src       string
+	pos       int
+	lineStart int       // offset of the current line in src
+	lines     [][]Token // tokens of finished lines, then the current one
+}
+
+func (lx *lexer) run() {
+	lx.lines = [][]Token{nil}
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '\n':
+			lx.newline()
+		case lx.lineComment():
+		case lx.blockComment():
+		case lx.string():
+		case c >= '0' && c <= '9' && !lx.afterWord():
+			lx.emit(lx.pos, lx.scanWhile(lx.pos, isNumberByte), Number)
+		case lx.wordStart():
+			lx.word()
+		default:
+			lx.pos++
+		}
+	}
+}
+
+// newline moves past the '\n' at pos to the next line.
+func (lx *lexer) newline() {
+	lx.pos++
+	lx.lineStart = lx.pos
+	lx.lines = append(lx.lines, nil)
+}
+
+// emit records [start, end) of the current line with class and moves pos to end.
+func (lx *lexer) emit(start, end int, class string) {
+	if end > start {
+		n := len(lx.lines) - 1
+		lx.lines[n] = append(lx.lines[n], Token{Start: start - lx.lineStart, End: end - lx.lineStart, Class: class})
+	}
+	lx.pos = end
+}
+
+// span emits class from pos up to and including close, across lines,
+// stopping at the end of the line instead if multiline is false. With
+// escapes, a backslash hides the byte after it.
+func (lx *lexer) span(open int, close string, class string, escapes, multiline bool) {
+	start, i := lx.pos, open
+	for i < len(lx.src) {
+		switch {
+		case escapes && lx.src[i] == '\\':
+			i++
+			if i < len(lx.src) && lx.src[i] != '\n' {
+				i++ // an escaped newline is still handled below
+			}
+			continue
+		case strings.HasPrefix(lx.src[i:], close):
+			lx.emit(start, i+len(close), class)
+			return
+		case lx.src[i] == '\n':
+			lx.emit(start, i, class)
+			if !multiline {
+				return
+			}
+			lx.newline()
+			start = lx.pos
+			i = lx.pos
+			continue
+		}
+		i++
+	}
+	lx.emit(start, len(lx.src), class)
+}
+
+func (lx *lexer) lineComment() bool {
+	for _, prefix := range lx.lang.lineComments {
+		if !strings.HasPrefix(lx.src[lx.pos:], prefix) {
+			continue
+		}
+		// "#" starts a comment only at a word boundary ("$#", "a#b" do not).
+		if prefix == "#" && lx.pos > lx.lineStart && !isSpace(lx.src[lx.pos-1]) {
+			continue
+		}
+		end := strings.IndexByte(lx.src[lx.pos:], '\n')
+		if end < 0 {
+			end = len(lx.src) - lx.pos
+		}
+		lx.emit(lx.pos, lx.pos+end, Comment)
+		return true
+	}
+	return false
+}
+
+func (lx *lexer) blockComment() bool {
+	for _, bc := range lx.lang.blockComments {
+		if strings.HasPrefix(lx.src[lx.pos:], bc[0]) {
+			lx.span(lx.pos+len(bc[0]), bc[1], Comment, false, true)
+			return true
+		}
+	}
+	return false
+}
+
+func (lx *lexer) string() bool {
+	for _, q := range lx.lang.strings {
+		if strings.HasPrefix(lx.src[lx.pos:], q.open) {
+			lx.span(lx.pos+len(q.open), q.close, String, q.escapes, q.multiline)
+			return true
+		}
+	}
+	return false
+}
+
+// word scans an identifier at pos and emits it if it is a keyword or type.
+func (lx *lexer) word() {
+	_, n := utf8.DecodeRuneInString(lx.src[lx.pos:])
+	start, end := lx.pos, lx.pos+n
+	for end < len(lx.src) {
+		r, n := utf8.DecodeRuneInString(lx.src[end:])
+		if !isWordRune(r) && !strings.ContainsRune(lx.lang.wordChars, r) {
+			break
+		}
+		end += n
+	}
+	w := lx.src[start:end]
+	if lx.lang.caseInsensitive {
+		w = strings.ToLower(w)
+	}
+	switch {
+	case lx.lang.keywords[w]:
+		lx.emit(start, end, Keyword)
+	case lx.lang.types[w]:
+		lx.emit(start, end, Type)
+	default:
+		lx.pos = end
+	}
+}
+
+// afterWord reports whether pos directly follows a letter, digit or
+// underscore, e.g. the 2 of "utf8" or "x2".
+func (lx *lexer) afterWord() bool {
+	if lx.pos == lx.lineStart {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(lx.src[lx.lineStart:lx.pos])
+	return isWordRune(r)
+}
+
+// scanWhile returns the end of the run of bytes from start satisfying ok.
+func (lx *lexer) scanWhile(start int, ok func(byte) bool) int {
+	end := start
+	for end < len(lx.src) && ok(lx.src[end]) {
+		end++
+	}
+	return end
+}
+
+// wordStart reports whether an identifier starts at pos.
+func (lx *lexer) wordStart() bool {
+	r, _ := utf8.DecodeRuneInString(lx.src[lx.pos:])
+	return r == '_' || unicode.IsLetter(r) || strings.ContainsRune(lx.lang.wordChars, r)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isNumberByte accepts digits, hex/exponent letters, separators and the
+// decimal point, which is loose but enough to colour 0x1F, 1_000 and 1.5e3.
+func isNumberByte(c byte) bool {
+	return c == '.' || c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
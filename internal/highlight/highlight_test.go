@@ -0,0 +1,97 @@
+package highlight
+
+import (
+	"reflect"
+	"testing"
+)
+
+// classes returns each token of lines as "class:text".
+func classes(content string, lines [][]Token) [][]string {
+	var out [][]string
+	offset := 0
+	for _, line := range splitForTest(content) {
+		var got []string
+		for _, tok := range lines[len(out)] {
+			got = append(got, tok.Class+":"+content[offset+tok.Start:offset+tok.End])
+		}
+		out = append(out, got)
+		offset += len(line) + 1
+	}
+	return out
+}
+
+func splitForTest(content string) []string {
+	var lines []string
+	start := 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			lines = append(lines, content[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(content) {
+		lines = append(lines, content[start:])
+	}
+	return lines
+}
+
+func TestTokenizeGo(t *testing.T) {
+	src := "func f() int {\n\t/* a\n\tb */ s := `x\ny` // done\n\treturn 0x1F\n}\n"
+	lines := Tokenize("go", src)
+	if len(lines) != 6 {
+		t.Fatalf("expected 6 lines, got %d", len(lines))
+	}
+	want := [][]string{
+		{"keyword:func", "type:int"},
+		{"comment:/* a"},
+		{"comment:\tb */", "string:`x"},
+		{"string:y`", "comment:// done"},
+		{"keyword:return", "number:0x1F"},
+		nil,
+	}
+	if got := classes(src, lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestTokenizeEdgeCases(t *testing.T) {
+	// An unterminated single-line string ends with its line; "#" inside a
+	// word is not a comment; SQL keywords match in any case.
+	cases := []struct {
+		lang, src string
+		want      [][]string
+	}{
+		{"python", "x = 'a\ny = 1 # c\n", [][]string{{"string:'a"}, {"number:1", "comment:# c"}}},
+		{"shell", "echo ${#a} $x#y\n", [][]string{{"type:echo"}}},
+		{"sql", "Select id FROM t -- all\n", [][]string{{"keyword:Select", "keyword:FROM", "comment:-- all"}}},
+		{"python", "s = \"\"\"a\nb\"\"\"", [][]string{{`string:"""a`}, {`string:b"""`}}},
+	}
+	for _, c := range cases {
+		if got := classes(c.src, Tokenize(c.lang, c.src)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s %q: got %q, want %q", c.lang, c.src, got, c.want)
+		}
+	}
+	if Tokenize("cobol", "x") != nil {
+		t.Error("expected nil for an unknown language")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	cases := []struct{ name, first, want string }{
+		{"cmd/main.go", "", "go"},
+		{"web/App.TSX", "", "typescript"},
+		{"build/Dockerfile.dev", "", "dockerfile"},
+		{"bin/tool", "#!/usr/bin/env python3", "python"},
+		{"bin/run", "#!/bin/bash -e", "shell"},
+		{"bin/x", "#!/usr/bin/env -S deno run", "typescript"},
+		{"README", "hello", ""},
+	}
+	for _, c := range cases {
+		if got := Detect(c.name, c.first); got != c.want {
+			t.Errorf("Detect(%q, %q) = %q, want %q", c.name, c.first, got, c.want)
+		}
+	}
+	if Lookup("C++") != "cpp" || Lookup("TypeScript") != "typescript" || Lookup("Haskell") != "" {
+		t.Error("Lookup misnames a linguist language")
+	}
+}
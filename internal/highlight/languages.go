@@ -0,0 +1,285 @@
+package highlight
+
+import (
+	"path"
+	"strings"
+)
+
+// language describes a language's lexical syntax.
+type language struct {
+	lineComments    []string
+	blockComments   [][2]string // opening and closing delimiters
+	strings         []quote     // longer openers first, e.g. `"""` before `"`
+	keywords        map[string]bool
+	types           map[string]bool
+	wordChars       string // characters besides letters, digits and '_' allowed in identifiers
+	caseInsensitive bool   // keywords match in any case; the sets are lower case
+}
+
+// quote is a string literal syntax.
+type quote struct {
+	open, close string
+	escapes     bool // a backslash escapes the next character
+	multiline   bool // may span lines
+}
+
+func words(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cStrings = []quote{{`"`, `"`, true, false}, {`'`, `'`, true, false}}
+	jsTypes  = "true false null undefined NaN Infinity this super Array Object String Number Boolean Promise Map Set Error JSON Math console"
+	jsWords  = "async await break case catch class const continue debugger default delete do else export extends finally for from function if import in instanceof let new of return static switch throw try typeof var void while with yield get set"
+)
+
+// languages maps the names Detect and Lookup return to their syntax.
+var languages = map[string]*language{
+	"go": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		strings:       []quote{{"`", "`", false, true}, {`"`, `"`, true, false}, {`'`, `'`, true, false}},
+		keywords:      words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var"),
+		types:         words("bool byte complex64 complex128 error float32 float64 int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr any comparable true false nil iota append cap clear close complex copy delete imag len make max min new panic print println real recover"),
+	},
+	"javascript": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		strings:       []quote{{"`", "`", true, true}, {`"`, `"`, true, false}, {`'`, `'`, true, false}},
+		keywords:      words(jsWords),
+		types:         words(jsTypes),
+		wordChars:     "$",
+	},
+	"typescript": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		strings:       []quote{{"`", "`", true, true}, {`"`, `"`, true, false}, {`'`, `'`, true, false}},
+		keywords:      words(jsWords + " abstract as asserts declare enum implements infer interface is keyof namespace private protected public readonly satisfies type"),
+		types:         words(jsTypes + " any boolean never number object string symbol unknown void bigint Record Partial Readonly"),
+		wordChars:     "$",
+	},
+	"python": {
+		lineComments: []string{"#"},
+		strings:      []quote{{`"""`, `"""`, true, true}, {`'''`, `'''`, true, true}, {`"`, `"`, true, false}, {`'`, `'`, true, false}},
+		keywords:     words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda match case nonlocal not or pass raise return try while with yield"),
+		types:        words("True False None self cls int float str bytes bool list dict set tuple object type len print range isinstance super Exception ValueError TypeError KeyError"),
+	},
+	"ruby": {
+		lineComments: []string{"#"},
+		strings:      []quote{{`"`, `"`, true, true}, {`'`, `'`, true, true}},
+		keywords:     words("alias and begin break case class def defined? do else elsif end ensure for if in module next not or redo rescue retry return self super then undef unless until when while yield require attr_accessor attr_reader private protected public"),
+		types:        words("true false nil"),
+		wordChars:    "?!",
+	},
+	"rust": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		// Single quotes are left alone: lifetimes ('a) would swallow the line.
+		strings:  []quote{{`"`, `"`, true, true}},
+		keywords: words("as async await break const continue crate dyn else enum extern fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait type unsafe use where while"),
+		types:    words("bool char f32 f64 i8 i16 i32 i64 i128 isize str u8 u16 u32 u64 u128 usize String Vec Option Result Box Some None Ok Err true false"),
+	},
+	"java": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		strings:       []quote{{`"""`, `"""`, true, true}, {`"`, `"`, true, false}, {`'`, `'`, true, false}},
+		keywords:      words("abstract assert break case catch class continue default do else enum extends final finally for if implements import instanceof interface native new package private protected public record return static super switch synchronized this throw throws transient try var void volatile while yield"),
+		types:         words("boolean byte char double float int long short String Object Integer Long List Map true false null"),
+	},
+	"kotlin": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		strings:       []quote{{`"""`, `"""`, false, true}, {`"`, `"`, true, false}, {`'`, `'`, true, false}},
+		keywords:      words("as break class companion continue data do else enum fun for if import in interface is object override package private protected public return sealed suspend this throw try typealias val var when while"),
+		types:         words("Any Boolean Byte Char Double Float Int Long Nothing Short String Unit List Map true false null"),
+	},
+	"c": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		strings:       cStrings,
+		keywords:      words("auto break case const continue default do else enum extern for goto if inline register restrict return sizeof static struct switch typedef union volatile while"),
+		types:         words("char double float int long short signed unsigned void bool size_t int8_t int16_t int32_t int64_t uint8_t uint16_t uint32_t uint64_t NULL true false"),
+	},
+	"cpp": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		strings:       cStrings,
+		keywords:      words("auto break case catch class const constexpr continue default delete do else enum explicit extern for friend goto if inline namespace new noexcept operator override private protected public return sizeof static struct switch template this throw try typedef typename union using virtual volatile while"),
+		types:         words("bool char double float int long short signed unsigned void size_t std string vector map nullptr true false"),
+	},
+	"csharp": {
+		lineComments:  []string{"//"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		strings:       []quote{{`@"`, `"`, false, true}, {`"`, `"`, true, false}, {`'`, `'`, true, false}},
+		keywords:      words("abstract as async await base break case catch class const continue default delegate do else enum event explicit extern finally fixed for foreach if implicit in interface internal is lock namespace new operator out override params private protected public readonly record ref return sealed sizeof static struct switch this throw try typeof using var virtual void volatile while"),
+		types:         words("bool byte char decimal double float int long object sbyte short string uint ulong ushort dynamic true false null"),
+	},
+	"php": {
+		lineComments:  []string{"//", "#"},
+		blockComments: [][2]string{{"/*", "*/"}},
+		strings:       []quote{{`"`, `"`, true, true}, {`'`, `'`, true, true}},
+		keywords:      words("abstract and as break case catch class clone const continue declare default do echo else elseif enum extends final finally fn for foreach function global if implements include interface match namespace new or private protected public readonly require return static switch throw trait try use var while yield"),
+		types:         words("array bool callable float int iterable mixed object string void true false null self parent"),
+		wordChars:     "$",
+	},
+	"shell": {
+		lineComments: []string{"#"},
+		strings:      []quote{{`"`, `"`, true, true}, {`'`, `'`, false, true}},
+		keywords:     words("case do done elif else esac fi for function if in select then until while local export readonly return exit set unset source"),
+		types:        words("echo printf cd test true false read shift eval exec trap"),
+	},
+	"sql": {
+		lineComments:    []string{"--"},
+		blockComments:   [][2]string{{"/*", "*/"}},
+		strings:         []quote{{`'`, `'`, false, true}, {`"`, `"`, false, false}},
+		keywords:        words("add all alter and as asc begin between by case check column commit constraint create cross database default delete desc distinct drop else end exists foreign from full group having if in index inner insert into is join key left like limit not null offset on or order outer primary references returning right rollback select set table then transaction union unique update using values view when where with"),
+		types:           words("bigint bool boolean char date decimal float int integer interval json jsonb numeric real serial smallint text time timestamp timestamptz uuid varchar true false"),
+		caseInsensitive: true,
+	},
+	"json": {
+		strings: []quote{{`"`, `"`, true, false}},
+		types:   words("true false null"),
+	},
+	"yaml": {
+		lineComments: []string{"#"},
+		strings:      []quote{{`"`, `"`, true, false}, {`'`, `'`, false, false}},
+		types:        words("true false null yes no on off"),
+	},
+	"toml": {
+		lineComments: []string{"#"},
+		strings:      []quote{{`"""`, `"""`, true, true}, {`'''`, `'''`, false, true}, {`"`, `"`, true, false}, {`'`, `'`, false, false}},
+		types:        words("true false"),
+	},
+	"css": {
+		blockComments: [][2]string{{"/*", "*/"}},
+		strings:       []quote{{`"`, `"`, true, false}, {`'`, `'`, true, false}},
+		keywords:      words("@media @import @keyframes @font-face @supports @layer @container"),
+		wordChars:     "-@",
+	},
+	"dockerfile": {
+		lineComments: []string{"#"},
+		strings:      []quote{{`"`, `"`, true, false}, {`'`, `'`, false, false}},
+		keywords:     words("FROM AS RUN CMD LABEL EXPOSE ENV ADD COPY ENTRYPOINT VOLUME USER WORKDIR ARG ONBUILD STOPSIGNAL HEALTHCHECK SHELL"),
+	},
+}
+
+// extensions maps file extensions to language names.
+var extensions = map[string]string{
+	".go": "go",
+	".js": "javascript", ".mjs": "javascript", ".cjs": "javascript", ".jsx": "javascript",
+	".ts": "typescript", ".mts": "typescript", ".cts": "typescript", ".tsx": "typescript",
+	".py": "python", ".pyi": "python",
+	".rb": "ruby", ".rake": "ruby", ".gemspec": "ruby",
+	".rs":   "rust",
+	".java": "java",
+	".kt":   "kotlin", ".kts": "kotlin",
+	".c": "c", ".h": "c",
+	".cc": "cpp", ".cpp": "cpp", ".cxx": "cpp", ".hh": "cpp", ".hpp": "cpp",
+	".cs":  "csharp",
+	".php": "php",
+	".sh":  "shell", ".bash": "shell", ".zsh": "shell",
+	".sql":  "sql",
+	".json": "json",
+	".yml":  "yaml", ".yaml": "yaml",
+	".toml": "toml",
+	".css":  "css", ".scss": "css", ".less": "css",
+}
+
+// filenames maps whole file names to language names.
+var filenames = map[string]string{
+	"Dockerfile":    "dockerfile",
+	"Containerfile": "dockerfile",
+	"Gemfile":       "ruby",
+	"Rakefile":      "ruby",
+	".bashrc":       "shell",
+	".zshrc":        "shell",
+	".profile":      "shell",
+	"go.mod":        "go",
+}
+
+// interpreters maps shebang interpreters to language names.
+var interpreters = map[string]string{
+	"sh": "shell", "bash": "shell", "zsh": "shell", "dash": "shell", "ksh": "shell",
+	"python": "python", "ruby": "ruby", "php": "php",
+	"node": "javascript", "deno": "typescript", "ts-node": "typescript", "bun": "typescript",
+}
+
+// Detect returns the language of the file at name (a slash-separated path)
+// from its file name, or else from a "#!" interpreter on its first line. It
+// returns "" if the language is not one Tokenize knows.
+func Detect(name, firstLine string) string {
+	base := path.Base(name)
+	if lang, ok := filenames[base]; ok {
+		return lang
+	}
+	if strings.HasPrefix(base, "Dockerfile.") {
+		return "dockerfile"
+	}
+	if lang, ok := extensions[strings.ToLower(path.Ext(base))]; ok {
+		return lang
+	}
+	return fromShebang(firstLine)
+}
+
+// fromShebang returns the language of a "#!/usr/bin/env python3" style line.
+func fromShebang(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+	interp := path.Base(fields[0])
+	if interp == "env" {
+		// Skip env's options, e.g. "env -S deno run".
+		interp = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interp = path.Base(f)
+				break
+			}
+		}
+	}
+	// python3, python3.12 and ruby2.7 name the same languages.
+	return interpreters[strings.TrimRight(interp, "0123456789.")]
+}
+
+// linguistNames maps lower-cased GitHub Linguist language names, as used by
+// the linguist-language attribute, to language names where they differ.
+var linguistNames = map[string]string{
+	"c++":        "cpp",
+	"c#":         "csharp",
+	"bash":       "shell",
+	"shell":      "shell",
+	"sh":         "shell",
+	"js":         "javascript",
+	"ts":         "typescript",
+	"tsx":        "typescript",
+	"jsx":        "javascript",
+	"golang":     "go",
+	"scss":       "css",
+	"plpgsql":    "sql",
+	"postgresql": "sql",
+	"tsql":       "sql",
+	"mysql":      "sql",
+	"yml":        "yaml",
+}
+
+// Lookup returns the language named name, a GitHub Linguist name such as
+// "Go", "TypeScript" or "C++" as given by a linguist-language attribute, or
+// "" if Tokenize does not know it.
+func Lookup(name string) string {
+	n := strings.ToLower(strings.TrimSpace(name))
+	if lang, ok := linguistNames[n]; ok {
+		return lang
+	}
+	if languages[n] != nil {
+		return n
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+// Package imagediff compares raster images pixel by pixel, producing an image
+// that shows where two versions of a file differ.
+package imagediff
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register decoders for Decode
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels is the largest image, in pixels, Decode accepts, so that a small
+// compressed file cannot claim gigabytes of memory.
+const MaxPixels = 40 << 20
+
+// Decode decodes a PNG, JPEG, GIF or WebP image. Other formats return an
+// error wrapping image.ErrFormat.
+func Decode(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("image is too large to compare (%dx%d)", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// changed is the colour of differing pixels.
+var changed = color.NRGBA{R: 0xff, G: 0x3b, B: 0x30, A: 0xff}
+
+// Diff compares before and after aligned at their top-left corners. It
+// returns an image as large as both in which differing pixels are solid red
+// and equal ones a faded grey copy of after, with the number of differing
+// pixels. Pixels covered by only one of the images differ.
+func Diff(before, after image.Image) (*image.NRGBA, int) {
+	ob, nb := before.Bounds(), after.Bounds()
+	w, h := max(ob.Dx(), nb.Dx()), max(ob.Dy(), nb.Dy())
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	n := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			op := image.Pt(ob.Min.X+x, ob.Min.Y+y)
+			np := image.Pt(nb.Min.X+x, nb.Min.Y+y)
+			if !op.In(ob) || !np.In(nb) || !sameColor(before.At(op.X, op.Y), after.At(np.X, np.Y)) {
+				out.SetNRGBA(x, y, changed)
+				n++
+				continue
+			}
+			out.SetNRGBA(x, y, faded(after.At(np.X, np.Y)))
+		}
+	}
+	return out, n
+}
+
+func sameColor(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
+
+// faded returns c as a light grey at a quarter of its opacity, so unchanged
+// areas stay recognisable without competing with the changes.
+func faded(c color.Color) color.NRGBA {
+	g := color.GrayModel.Convert(c).(color.Gray)
+	_, _, _, a := c.RGBA()
+	return color.NRGBA{R: g.Y, G: g.Y, B: g.Y, A: uint8(a >> 10)}
+}
@@ -0,0 +1,69 @@
+package imagediff
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func solid(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestDiff(t *testing.T) {
+	white := color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	before := solid(4, 4, white)
+	after := solid(4, 4, white)
+	after.Set(1, 2, color.NRGBA{A: 0xff})
+
+	out, n := Diff(before, after)
+	if n != 1 {
+		t.Errorf("expected 1 changed pixel, got %d", n)
+	}
+	if out.NRGBAAt(1, 2) != changed {
+		t.Errorf("changed pixel: got %v", out.NRGBAAt(1, 2))
+	}
+	if c := out.NRGBAAt(0, 0); c == changed || c.A == 0 {
+		t.Errorf("unchanged pixel: got %v", c)
+	}
+}
+
+func TestDiffSizes(t *testing.T) {
+	c := color.NRGBA{R: 10, A: 0xff}
+	out, n := Diff(solid(2, 2, c), solid(3, 2, c))
+	if b := out.Bounds(); b.Dx() != 3 || b.Dy() != 2 {
+		t.Errorf("bounds: got %v", b)
+	}
+	if n != 2 {
+		t.Errorf("expected the extra column to differ, got %d pixels", n)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, solid(2, 3, color.Black)); err != nil {
+		t.Fatal(err)
+	}
+	img, err := Decode(buf.Bytes())
+	if err != nil || img.Bounds().Dx() != 2 || img.Bounds().Dy() != 3 {
+		t.Fatalf("Decode: %v, %v", img, err)
+	}
+	// A 1x1 lossless WebP.
+	webp, _ := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	if img, err := Decode(webp); err != nil || img.Bounds().Dx() != 1 || img.Bounds().Dy() != 1 {
+		t.Errorf("webp: %v, %v", img, err)
+	}
+	if _, err := Decode([]byte("<svg xmlns='http://www.w3.org/2000/svg'/>")); !errors.Is(err, image.ErrFormat) {
+		t.Errorf("svg: expected image.ErrFormat, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// tokenHeader carries the launch token for non-browser clients (curl, scripts).
+const tokenHeader = "X-Prview-Token"
+
+// tokenParam is the query parameter used in the URL prview prints and opens.
+// A page load carrying it is exchanged for a cookie and redirected away, so
+// the token does not linger in browser history.
+const tokenParam = "token"
+
+// guard wraps h with the request checks that keep other websites out:
+//
+//   - Host must name this server (an IP literal, localhost, or the listen host)
+//     so a DNS-rebound hostname cannot reach the API as same-origin.
+//   - Mutating requests and WebSocket upgrades must carry a matching Origin,
+//     when the browser sends one.
+//   - Mutating requests and WebSocket upgrades must present the launch token,
+//     via cookie or the X-Prview-Token header.
+//
+// Host checking is skipped for Unix sockets, whose access is governed by file
+// permissions and which are typically fronted by a proxy that rewrites Host.
+// Token checking is skipped when cfg.Token is empty.
+func (s *srv) guard(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			writeError(w, "invalid Host header", http.StatusForbidden)
+			return
+		}
+
+		if r.URL.Query().Has(tokenParam) && r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") {
+			s.exchangeToken(w, r)
+			return
+		}
+
+		if isMutating(r) || isWebSocketUpgrade(r) {
+			if !sameOrigin(r) {
+				writeError(w, "cross-origin request rejected", http.StatusForbidden)
+				return
+			}
+			if !s.hasToken(r) {
+				writeError(w, "missing or invalid token — open the URL printed by prview", http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// exchangeToken handles a page load with ?token=: a valid token is stored in
+// a cookie, then the browser is redirected to the same URL without it.
+func (s *srv) exchangeToken(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if !s.tokenMatches(q.Get(tokenParam)) {
+		http.Error(w, "invalid token", http.StatusForbidden)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		Value:    s.cfg.Token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	q.Del(tokenParam)
+	target := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	http.Redirect(w, r, target.String(), http.StatusSeeOther)
+}
+
+// hasToken reports whether r carries the launch token.
+func (s *srv) hasToken(r *http.Request) bool {
+	if s.cfg.Token == "" {
+		return true
+	}
+	if s.tokenMatches(r.Header.Get(tokenHeader)) {
+		return true
+	}
+	if c, err := r.Cookie(s.cookieName()); err == nil && s.tokenMatches(c.Value) {
+		return true
+	}
+	return false
+}
+
+func (s *srv) tokenMatches(v string) bool {
+	return v != "" && subtle.ConstantTimeCompare([]byte(v), []byte(s.cfg.Token)) == 1
+}
+
+// cookieName includes the port because cookies are shared across ports:
+// two prview instances on one machine must not overwrite each other's token.
+func (s *srv) cookieName() string {
+	if _, port, err := net.SplitHostPort(s.cfg.Addr); err == nil {
+		return "prview_token_" + port
+	}
+	return "prview_token"
+}
+
+// allowedHost reports whether the Host header names this server.
+func (s *srv) allowedHost(hostport string) bool {
+	if s.cfg.Addr == "" || strings.HasPrefix(s.cfg.Addr, "unix:") {
+		return true
+	}
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "" {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil {
+		return true
+	}
+	listenHost, _, err := net.SplitHostPort(s.cfg.Addr)
+	return err == nil && strings.EqualFold(host, listenHost)
+}
+
+// sameOrigin reports whether the request's Origin, if any, matches its Host.
+// Browsers always send Origin on cross-origin POST/DELETE and WebSocket
+// handshakes; its absence means a non-browser client.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false // includes the opaque "null" origin
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func isMutating(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
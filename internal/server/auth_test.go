@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGuard(t *testing.T) {
+	s := &srv{cfg: Config{Addr: "127.0.0.1:8888", Token: "secret"}}
+	h := s.guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		host   string
+		header map[string]string
+		want   int
+	}{
+		{"read without token", http.MethodGet, "/api/diff", "127.0.0.1:8888", nil, http.StatusNoContent},
+		{"localhost host", http.MethodGet, "/api/diff", "localhost:8888", nil, http.StatusNoContent},
+		{"rebound host", http.MethodGet, "/api/diff", "evil.test:8888", nil, http.StatusForbidden},
+		{"empty host", http.MethodGet, "/api/diff", "", nil, http.StatusForbidden},
+		{"post with header token", http.MethodPost, "/api/stage", "127.0.0.1:8888",
+			map[string]string{tokenHeader: "secret"}, http.StatusNoContent},
+		{"post with cookie token", http.MethodPost, "/api/stage", "127.0.0.1:8888",
+			map[string]string{"Cookie": "prview_token_8888=secret", "Origin": "http://127.0.0.1:8888"}, http.StatusNoContent},
+		{"post without token", http.MethodPost, "/api/stage", "127.0.0.1:8888", nil, http.StatusForbidden},
+		{"post with wrong token", http.MethodPost, "/api/stage", "127.0.0.1:8888",
+			map[string]string{tokenHeader: "guess"}, http.StatusForbidden},
+		{"cross-origin post", http.MethodPost, "/api/stage", "127.0.0.1:8888",
+			map[string]string{tokenHeader: "secret", "Origin": "http://evil.test"}, http.StatusForbidden},
+		{"null origin post", http.MethodPost, "/api/stage", "127.0.0.1:8888",
+			map[string]string{tokenHeader: "secret", "Origin": "null"}, http.StatusForbidden},
+		{"websocket without token", http.MethodGet, "/ws", "127.0.0.1:8888",
+			map[string]string{"Upgrade": "websocket"}, http.StatusForbidden},
+		{"cross-origin websocket", http.MethodGet, "/ws", "127.0.0.1:8888",
+			map[string]string{"Upgrade": "websocket", tokenHeader: "secret", "Origin": "http://evil.test"}, http.StatusForbidden},
+		{"wrong token exchange", http.MethodGet, "/?token=guess", "127.0.0.1:8888", nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Host = tt.host
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestGuardTokenExchange(t *testing.T) {
+	s := &srv{cfg: Config{Addr: "127.0.0.1:8888", Token: "secret"}}
+	h := s.guard(http.NotFoundHandler())
+
+	r := httptest.NewRequest(http.MethodGet, "/?repo=app&token=secret", nil)
+	r.Host = "127.0.0.1:8888"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if loc := w.Header().Get("Location"); loc != "/?repo=app" {
+		t.Errorf("redirect to %q, want the URL without the token", loc)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "prview_token_8888" || cookies[0].Value != "secret" || !cookies[0].HttpOnly {
+		t.Errorf("unexpected cookies %+v", cookies)
+	}
+
+	// The API never exchanges tokens, so they cannot be set cross-site.
+	r = httptest.NewRequest(http.MethodGet, "/api/diff?token=secret", nil)
+	r.Host = "127.0.0.1:8888"
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || len(w.Result().Cookies()) != 0 {
+		t.Errorf("/api/ request with token: status %d, cookies %+v", w.Code, w.Result().Cookies())
+	}
+}
+
+func TestGuardUnixSocket(t *testing.T) {
+	s := &srv{cfg: Config{Addr: "unix:/tmp/prview.sock"}}
+	h := s.guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	// A proxy in front of the socket may send any Host, and no token is set.
+	r := httptest.NewRequest(http.MethodPost, "/api/stage", nil)
+	r.Host = "review.example.test"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
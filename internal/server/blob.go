@@ -0,0 +1,135 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/flatcoke/prview/internal/git"
+	"github.com/flatcoke/prview/internal/imagediff"
+)
+
+const (
+	// maxBlobSize is the largest file /api/blob serves.
+	maxBlobSize = 50 << 20
+	// maxImageDiffSize is the largest image /api/imagediff decodes.
+	maxImageDiffSize = 20 << 20
+)
+
+// imageTypes are the content types of the image formats the UI can show.
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+}
+
+// handleBlob serves GET /api/blob — the raw bytes of one side of a file, with
+// an image content type for images and application/octet-stream otherwise.
+//
+// Query: as for /api/file.
+func (s *srv) handleBlob(w http.ResponseWriter, r *http.Request) {
+	dir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	p, blob, ok := s.fileSide(w, r, dir)
+	if !ok {
+		return
+	}
+	data, ok := readBlob(w, dir, p, blob, maxBlobSize)
+	if !ok {
+		return
+	}
+	contentType, ok := imageTypes[strings.ToLower(path.Ext(p))]
+	if !ok {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	// Blobs are repository content: never let one run as a page (an SVG can
+	// hold scripts) or be sniffed as something else.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// handleImageDiff serves GET /api/imagediff — a PNG marking the pixels that
+// differ between the old and new side of an image in the diff, with their
+// count in the X-Changed-Pixels header. PNG, JPEG, GIF and WebP are supported;
+// other formats get 415.
+//
+// Query: repo, worktree, path and the diff parameters, as for /api/file
+// without ref.
+func (s *srv) handleImageDiff(w http.ResponseWriter, r *http.Request) {
+	dir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("path") == "" {
+		writeError(w, "path parameter required", http.StatusBadRequest)
+		return
+	}
+	result, err := s.computeDiff(r, dir)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f := result.File(q.Get("path"), q.Get("layer"))
+	if f == nil {
+		writeError(w, q.Get("path")+" is not in the diff", http.StatusNotFound)
+		return
+	}
+
+	var imgs [2]image.Image
+	for i, side := range []string{"old", "new"} {
+		p, blob, ok := diffSide(w, f, side)
+		if !ok {
+			return
+		}
+		data, ok := readBlob(w, dir, p, blob, maxImageDiffSize)
+		if !ok {
+			return
+		}
+		if imgs[i], err = imagediff.Decode(data); err != nil {
+			status := http.StatusUnprocessableEntity
+			if errors.Is(err, image.ErrFormat) {
+				status = http.StatusUnsupportedMediaType
+			}
+			writeError(w, fmt.Sprintf("%s side: %v", side, err), status)
+			return
+		}
+	}
+
+	out, changed := imagediff.Diff(imgs[0], imgs[1])
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("X-Changed-Pixels", strconv.Itoa(changed))
+	png.Encode(w, out)
+}
+
+// readBlob reads blob as git.ReadBlob does, writing an error if it is larger
+// than limit or cannot be read.
+func readBlob(w http.ResponseWriter, dir, path, blob string, limit int64) ([]byte, bool) {
+	data, size, err := git.ReadBlobLimit(dir, path, blob, limit)
+	if errors.Is(err, git.ErrBlobTooLarge) {
+		writeError(w, fmt.Sprintf("%s is too large (%d bytes)", path, size), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	if errors.Is(err, git.ErrStaleContent) {
+		writeError(w, err.Error(), http.StatusConflict)
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/flatcoke/prview/internal/git"
+)
+
+// handleCheckpoint serves the review checkpoint of the repo's current branch,
+// which mode=since diffs against.
+//
+//	GET    /api/checkpoint   current checkpoint, 404 if none
+//	POST   /api/checkpoint   record the working tree as the new checkpoint
+//	DELETE /api/checkpoint   forget the checkpoint
+//
+// repo and worktree select the repository as for /api/diff. A checkpoint only
+// adds a ref under refs/prview, so it stays available in read-only mode.
+func (s *srv) handleCheckpoint(w http.ResponseWriter, r *http.Request) {
+	dir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	branch := git.CurrentBranch(dir)
+
+	var cp *git.Checkpoint
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		cp, err = git.LoadCheckpoint(dir, branch)
+	case http.MethodPost:
+		cp, err = git.SaveCheckpoint(dir, branch)
+	case http.MethodDelete:
+		err = git.DeleteCheckpoint(dir, branch)
+	default:
+		writeError(w, "GET, POST or DELETE required", http.StatusMethodNotAllowed)
+		return
+	}
+	if errors.Is(err, git.ErrNoCheckpoint) {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if cp == nil {
+		writeJSON(w, map[string]string{"ok": "deleted"})
+		return
+	}
+	writeJSON(w, cp)
+}
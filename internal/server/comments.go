@@ -0,0 +1,200 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/flatcoke/prview/internal/git"
+)
+
+// handleComments serves the review comments of the repo's current branch.
+//
+//	GET    /api/comments                                   list
+//	POST   /api/comments?path=&side=&line=  (form: body)   add
+//	PUT    /api/comments?id=                (form: body)   edit
+//	DELETE /api/comments?id=                               delete
+//
+// repo and worktree select the repository as for /api/diff. POST also takes
+// the diff parameters (mode, base, ...) of the view the comment was written
+// in, since the line is anchored against that diff. POST and PUT also store
+// moves of existing comments, see saveAnchors. Comments are local notes
+// stored under the git dir, so they stay available in read-only mode.
+func (s *srv) handleComments(w http.ResponseWriter, r *http.Request) {
+	dir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	branch := git.CurrentBranch(dir)
+	q := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		comments, err := git.ListComments(dir, branch)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, comments)
+
+	case http.MethodPost:
+		line, err := strconv.Atoi(q.Get("line"))
+		if err != nil || q.Get("path") == "" {
+			writeError(w, "path and line parameters required", http.StatusBadRequest)
+			return
+		}
+		body := r.FormValue("body")
+		if body == "" {
+			writeError(w, "body required", http.StatusBadRequest)
+			return
+		}
+		result, err := s.computeDiff(r, dir)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		c, err := git.AddComment(dir, branch, result, q.Get("path"), q.Get("side"), line, body)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.saveAnchors(dir, branch)
+		writeJSON(w, c)
+
+	case http.MethodPut:
+		body := r.FormValue("body")
+		if body == "" {
+			writeError(w, "body required", http.StatusBadRequest)
+			return
+		}
+		c, err := git.UpdateComment(dir, branch, q.Get("id"), body)
+		if err != nil {
+			writeCommentError(w, err)
+			return
+		}
+		s.saveAnchors(dir, branch)
+		writeJSON(w, c)
+
+	case http.MethodDelete:
+		if err := git.DeleteComment(dir, branch, q.Get("id")); err != nil {
+			writeCommentError(w, err)
+			return
+		}
+		writeJSON(w, map[string]string{"ok": "deleted"})
+
+	default:
+		writeError(w, "GET, POST, PUT or DELETE required", http.StatusMethodNotAllowed)
+	}
+}
+
+// saveAnchors stores comment moves against the canonical diff — every change
+// against the base (or the launch-time refs), with default options and
+// untracked files — so that no particular view moves comments for good. It
+// runs on comment writes only; reads anchor without storing. Failures are
+// logged, as the comments stay valid at their stored lines.
+func (s *srv) saveAnchors(dir, branch string) {
+	args := s.cfg.RefArgs
+	if len(args) == 0 {
+		args = []string{git.DefaultBranch(dir)}
+	}
+	var result *git.DiffResult
+	var err error
+	if dir == "" {
+		result, err = git.Diff(git.DiffOptions{}, args)
+	} else {
+		result, err = git.DiffInRepo(dir, git.DiffOptions{}, args)
+	}
+	if err == nil {
+		err = git.AddUntracked(dir, result)
+	}
+	if err == nil {
+		err = git.SaveAnchors(dir, branch, result)
+	}
+	if err != nil {
+		log.Printf("comments: save anchors: %v", err)
+	}
+}
+
+// Formats accepted by /api/comments/export.
+const (
+	exportGitHub   = "github"
+	exportGitLab   = "gitlab"
+	exportMarkdown = "markdown"
+)
+
+// handleCommentsExport serves GET /api/comments/export?format=github|gitlab|markdown.
+// Comments are anchored, without storing any moves, against the diff
+// selected by the request's diff parameters, as for /api/diff. The github and
+// gitlab formats default to mode=branch, since a review's lines must exist
+// in its commit; uncommitted lines would be rejected. The output is meant to
+// be pasted or piped into the forge's API by the caller — nothing is sent
+// anywhere.
+func (s *srv) handleCommentsExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	dir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportMarkdown
+	}
+	if format != exportGitHub && format != exportGitLab && format != exportMarkdown {
+		writeError(w, "format must be github, gitlab or markdown", http.StatusBadRequest)
+		return
+	}
+
+	if q := r.URL.Query(); format != exportMarkdown && !q.Has("mode") {
+		q.Set("mode", diffModeBranch)
+		r = r.Clone(r.Context())
+		r.URL.RawQuery = q.Encode()
+	}
+	branch := git.CurrentBranch(dir)
+	result, err := s.computeDiff(r, dir)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	comments, err := git.AnchorComments(dir, branch, result)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if format == exportMarkdown {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Write([]byte(git.ExportMarkdown(branch, comments)))
+		return
+	}
+
+	base := r.URL.Query().Get("base")
+	if base == "" {
+		base = git.DefaultBranch(dir)
+	}
+	refs, err := git.ResolveReviewRefs(dir, base)
+	if errors.Is(err, git.ErrInvalidRevision) {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if format == exportGitHub {
+		writeJSON(w, git.ExportGitHub(comments, refs.Head))
+		return
+	}
+	writeJSON(w, git.ExportGitLab(result, comments, refs))
+}
+
+// writeCommentError maps a missing comment to 404 and everything else to 500.
+func writeCommentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, git.ErrCommentNotFound) {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeError(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/flatcoke/prview/internal/git"
+)
+
+// handleContext serves GET /api/context — lines of one side of a file in the
+// diff, for expanding the context collapsed between and around hunks.
+//
+// Query: repo, worktree (as for /api/diff), path (the file's path on that
+// side), blob (the file's oldBlob or newBlob from the diff) and from/to
+// (1-based, inclusive; to is clamped to the file). If the blob is the working
+// tree's and the file has since changed, 409 is returned; if it is larger
+// than /api/file returns content for, 413.
+func (s *srv) handleContext(w http.ResponseWriter, r *http.Request) {
+	dir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("path") == "" || q.Get("blob") == "" {
+		writeError(w, "path and blob parameters required", http.StatusBadRequest)
+		return
+	}
+	from, err1 := strconv.Atoi(q.Get("from"))
+	to, err2 := strconv.Atoi(q.Get("to"))
+	if err1 != nil || err2 != nil || from < 1 || to < from {
+		writeError(w, "from and to must be line numbers with from <= to", http.StatusBadRequest)
+		return
+	}
+	lines, total, err := git.BlobLines(dir, q.Get("path"), q.Get("blob"), from, to)
+	if errors.Is(err, git.ErrStaleContent) {
+		writeError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, git.ErrBlobTooLarge) {
+		writeError(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"from":  from,
+		"lines": lines,
+		"total": total,
+	})
+}
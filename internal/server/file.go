@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/flatcoke/prview/internal/git"
+)
+
+// handleFile serves GET /api/file — the full content of one side of a file.
+//
+// Query: repo, worktree (as for /api/diff), path and side (old or new,
+// default new). With ref, the file is read from that revision. Otherwise the
+// file is looked up in the diff selected by the request's diff parameters
+// (mode, base, ..., and layer in layers mode) and the side is the blob that
+// diff compares: the base ref's, the index's or the working tree's.
+func (s *srv) handleFile(w http.ResponseWriter, r *http.Request) {
+	dir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	path, blob, ok := s.fileSide(w, r, dir)
+	if !ok {
+		return
+	}
+	content, err := git.ReadFileContent(dir, path, blob)
+	if errors.Is(err, git.ErrStaleContent) {
+		writeError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, content)
+}
+
+// fileSide resolves the path, side and ref parameters of /api/file and
+// /api/blob to the path and blob to read, writing an error if it cannot.
+func (s *srv) fileSide(w http.ResponseWriter, r *http.Request, dir string) (string, string, bool) {
+	q := r.URL.Query()
+	path, side := q.Get("path"), q.Get("side")
+	if path == "" {
+		writeError(w, "path parameter required", http.StatusBadRequest)
+		return "", "", false
+	}
+	if side == "" {
+		side = "new"
+	}
+	if side != "old" && side != "new" {
+		writeError(w, "side must be old or new", http.StatusBadRequest)
+		return "", "", false
+	}
+
+	if ref := q.Get("ref"); ref != "" {
+		blob, err := git.BlobAt(dir, ref, path)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusNotFound)
+			return "", "", false
+		}
+		return path, blob, true
+	}
+	result, err := s.computeDiff(r, dir)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return "", "", false
+	}
+	f := result.File(path, q.Get("layer"))
+	if f == nil {
+		writeError(w, path+" is not in the diff", http.StatusNotFound)
+		return "", "", false
+	}
+	return diffSide(w, f, side)
+}
+
+// diffSide returns the path and blob of side (old or new) of f, writing an
+// error if f has no such side.
+func diffSide(w http.ResponseWriter, f *git.FileDiff, side string) (string, string, bool) {
+	blob, path := f.NewBlob, f.NewName
+	if side == "old" {
+		blob, path = f.OldBlob, f.OldName
+	}
+	// Added and deleted files have the null blob on their missing side.
+	if path == "/dev/null" || strings.Trim(blob, "0") == "" {
+		writeError(w, "the file has no "+side+" side in this diff", http.StatusNotFound)
+		return "", "", false
+	}
+	return path, blob, true
+}
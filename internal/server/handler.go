@@ -3,10 +3,13 @@ package server
 import (
 	"embed"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,6 +30,9 @@ const (
 	diffModeBranch      = "branch"
 	diffModeAll         = "all"
 	diffModeUncommitted = "uncommitted"
+	diffModeLayers      = "layers" // staged and unstaged changes side by side
+	diffModeSince       = "since"  // working tree vs the branch's review checkpoint
+	diffModeRange       = "range"  // range-diff of an earlier version of the branch vs HEAD
 )
 
 //go:embed static/*
@@ -35,15 +41,19 @@ var staticFS embed.FS
 // Config holds server configuration.
 type Config struct {
 	Port      int
+	Addr      string // Bound listen address: "host:port" or "unix:/path.sock"
+	Token     string // Per-launch secret required on mutating requests; empty disables the check
+	ReadOnly  bool   // Disable endpoints that discard work or delete branches/worktrees
 	Staged    bool
 	All       bool
 	RefArgs   []string
-	WorkDir   string // The directory prview was launched in
-	Workspace bool   // True if workspace mode (multiple repos)
+	Diff      git.DiffOptions // Defaults for the algorithm, whitespace and context query parameters
+	WorkDir   string          // The directory prview was launched in
+	Workspace bool            // True if workspace mode (multiple repos)
 }
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+	CheckOrigin: sameOrigin,
 }
 
 // srv holds the shared state for all HTTP handlers.
@@ -85,15 +95,30 @@ func New(cfg Config) http.Handler {
 		staticHandler.ServeHTTP(w, r)
 	})
 
+	mux.HandleFunc("/api/config", s.handleConfig)
 	mux.HandleFunc("/api/branches", s.handleBranches)
 	mux.HandleFunc("/api/worktrees", s.handleWorktrees)
 	mux.HandleFunc("/api/clear", s.handleClear)
+	mux.HandleFunc("/api/snapshots", s.handleSnapshots)
 	mux.HandleFunc("/api/hide", s.handleHide)
 	mux.HandleFunc("/api/repos", s.handleRepos)
 	mux.HandleFunc("/api/diff", s.handleDiff)
+	mux.HandleFunc("/api/stage", s.handleStage(false))
+	mux.HandleFunc("/api/unstage", s.handleStage(true))
+	mux.HandleFunc("/api/discard", s.handleDiscard)
+	mux.HandleFunc("/api/comments", s.handleComments)
+	mux.HandleFunc("/api/comments/export", s.handleCommentsExport)
+	mux.HandleFunc("/api/viewed", s.handleViewed)
+	mux.HandleFunc("/api/checkpoint", s.handleCheckpoint)
+	mux.HandleFunc("/api/commits", s.handleCommits)
+	mux.HandleFunc("/api/tips", s.handleTips)
+	mux.HandleFunc("/api/context", s.handleContext)
+	mux.HandleFunc("/api/file", s.handleFile)
+	mux.HandleFunc("/api/blob", s.handleBlob)
+	mux.HandleFunc("/api/imagediff", s.handleImageDiff)
 	mux.HandleFunc("/ws", s.handleWS)
 
-	return mux
+	return s.guard(mux)
 }
 
 // writeJSON writes v as JSON to w, setting the Content-Type header.
@@ -109,6 +134,39 @@ func writeError(w http.ResponseWriter, msg string, code int) {
 	json.NewEncoder(w).Encode(map[string]string{"error": msg})
 }
 
+// capabilities reports which destructive actions the server permits.
+// The frontend hides controls for anything reported false.
+func (s *srv) capabilities() map[string]bool {
+	allowed := !s.cfg.ReadOnly
+	return map[string]bool{
+		"clear":          allowed,
+		"deleteBranch":   allowed,
+		"deleteWorktree": allowed,
+		"snapshots":      allowed,
+		"stage":          allowed,
+		"discard":        allowed,
+	}
+}
+
+// denyReadOnly writes a 403 and returns true if the server is read-only.
+func (s *srv) denyReadOnly(w http.ResponseWriter) bool {
+	if !s.cfg.ReadOnly {
+		return false
+	}
+	writeError(w, "prview is running in read-only mode", http.StatusForbidden)
+	return true
+}
+
+// handleConfig serves GET /api/config — server mode, capability set and
+// default diff options.
+func (s *srv) handleConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"readOnly":     s.cfg.ReadOnly,
+		"capabilities": s.capabilities(),
+		"diffOptions":  s.cfg.Diff,
+	})
+}
+
 // handleBranches serves GET /api/branches (list) and DELETE /api/branches (remove).
 func (s *srv) handleBranches(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodDelete {
@@ -143,6 +201,31 @@ func (s *srv) handleBranches(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleCommits serves GET /api/commits — the commits of the current branch
+// that are not on base (default: the repo's default branch), oldest first.
+// repo and worktree select the repository as for /api/diff; each commit's hash
+// can be passed back to /api/diff as commit=, from= or to= in branch mode.
+func (s *srv) handleCommits(w http.ResponseWriter, r *http.Request) {
+	repoDir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	base := r.URL.Query().Get("base")
+	if base == "" {
+		base = git.DefaultBranch(repoDir)
+	}
+	commits, err := git.ListCommits(repoDir, base)
+	if errors.Is(err, git.ErrInvalidRevision) {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"base": base, "commits": commits})
+}
+
 // handleWorktrees serves GET /api/worktrees (list) and DELETE /api/worktrees (remove).
 func (s *srv) handleWorktrees(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodDelete {
@@ -173,12 +256,16 @@ func (s *srv) handleWorktrees(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]interface{}{"worktrees": worktrees})
 }
 
-// handleClear serves POST /api/clear — runs git checkout . + git clean -fd.
+// handleClear serves POST /api/clear — snapshots the dirty state, then runs
+// git checkout . + git clean -fd.
 func (s *srv) handleClear(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, "POST required", http.StatusMethodNotAllowed)
 		return
 	}
+	if s.denyReadOnly(w) {
+		return
+	}
 	repoName := r.URL.Query().Get("repo")
 	if repoName == "" {
 		writeError(w, "repo parameter required", http.StatusBadRequest)
@@ -189,11 +276,63 @@ func (s *srv) handleClear(w http.ResponseWriter, r *http.Request) {
 		writeError(w, "invalid repo name", http.StatusBadRequest)
 		return
 	}
-	if err := git.ClearRepo(repoDir); err != nil {
+	snap, err := git.ClearRepo(repoDir)
+	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, map[string]string{"ok": "cleared"})
+	writeJSON(w, map[string]interface{}{"ok": "cleared", "snapshot": snap})
+}
+
+// handleSnapshots serves GET /api/snapshots (list), POST /api/snapshots (restore,
+// or restore a single file with path=) and DELETE /api/snapshots (purge one,
+// or all with all=true). repo and worktree select the repository as for /api/diff.
+func (s *srv) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	repoDir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		snapshots, err := git.ListSnapshots(repoDir)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"snapshots": snapshots})
+	case http.MethodPost:
+		if s.denyReadOnly(w) {
+			return
+		}
+		var err error
+		if path := r.URL.Query().Get("path"); path != "" {
+			err = git.RestoreSnapshotFile(repoDir, r.URL.Query().Get("id"), path)
+		} else {
+			err = git.RestoreSnapshot(repoDir, r.URL.Query().Get("id"))
+		}
+		if err != nil {
+			writeError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeJSON(w, map[string]string{"ok": "restored"})
+	case http.MethodDelete:
+		if s.denyReadOnly(w) {
+			return
+		}
+		if r.URL.Query().Get("all") == "true" {
+			deleted, errs := git.DeleteAllSnapshots(repoDir)
+			writeJSON(w, map[string]interface{}{"deleted": deleted, "errors": errs})
+			return
+		}
+		if err := git.DeleteSnapshot(repoDir, r.URL.Query().Get("id")); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]string{"ok": "deleted"})
+	default:
+		writeError(w, "GET, POST or DELETE required", http.StatusMethodNotAllowed)
+	}
 }
 
 // handleHide serves POST /api/hide (hide repo) and DELETE /api/hide (unhide repo).
@@ -246,62 +385,160 @@ func (s *srv) handleRepos(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleDiff serves GET /api/diff.
+// handleDiff serves GET /api/diff. With highlight=true, lines carry syntax
+// highlighting tokens.
 func (s *srv) handleDiff(w http.ResponseWriter, r *http.Request) {
-	repoName := r.URL.Query().Get("repo")
-
-	if s.cfg.Workspace && repoName != "" {
-		repoDir, ok := safeRepoPath(s.cfg.WorkDir, repoName)
-		if !ok {
-			writeError(w, "invalid repo name", http.StatusBadRequest)
-			return
-		}
-		if !git.IsGitRepo(repoDir) {
-			writeError(w, "not a git repository", http.StatusNotFound)
+	diffDir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	for _, name := range []string{"commit", "from", "to"} {
+		if v := q.Get(name); v != "" && !git.IsCommitID(v) {
+			writeError(w, "invalid "+name+" parameter: commit hash expected", http.StatusBadRequest)
 			return
 		}
+	}
+	if _, err := diffOptions(s.cfg, r); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if isRangeMode(s.cfg, r) {
+		s.writeRangeDiff(w, r, diffDir)
+		return
+	}
+	s.writeDiff(w, r, diffDir)
+}
 
-		diffDir := repoDir
-		if worktreeName := r.URL.Query().Get("worktree"); worktreeName != "" {
-			worktrees, err := git.GitWorktrees(repoDir)
-			if err != nil {
-				writeError(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			found := false
-			for _, wt := range worktrees {
-				if wt.Name == worktreeName {
-					diffDir = wt.Path
-					found = true
-					break
-				}
-			}
-			if !found {
-				writeError(w, "worktree not found", http.StatusNotFound)
-				return
-			}
-		}
+// diffDir resolves the directory git should run in for a diff-scoped request:
+// the repo (and optional worktree) named by the query in workspace mode, or ""
+// in single-repo mode (git runs in CWD). On failure it writes the error
+// response and returns ok=false.
+func (s *srv) diffDir(w http.ResponseWriter, r *http.Request) (string, bool) {
+	repoName := r.URL.Query().Get("repo")
+	if !s.cfg.Workspace || repoName == "" {
+		return "", true
+	}
 
-		args := buildDiffArgs(s.cfg, r, diffDir)
-		result, err := git.DiffInRepo(diffDir, args)
-		if err != nil {
-			writeError(w, err.Error(), http.StatusInternalServerError)
-			return
+	repoDir, ok := safeRepoPath(s.cfg.WorkDir, repoName)
+	if !ok {
+		writeError(w, "invalid repo name", http.StatusBadRequest)
+		return "", false
+	}
+	if !git.IsGitRepo(repoDir) {
+		writeError(w, "not a git repository", http.StatusNotFound)
+		return "", false
+	}
+
+	worktreeName := r.URL.Query().Get("worktree")
+	if worktreeName == "" {
+		return repoDir, true
+	}
+	worktrees, err := git.GitWorktrees(repoDir)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	for _, wt := range worktrees {
+		if wt.Name == worktreeName {
+			return wt.Path, true
 		}
-		writeJSON(w, result)
-		return
 	}
+	writeError(w, "worktree not found", http.StatusNotFound)
+	return "", false
+}
 
-	// Single repo mode.
-	args := buildDiffArgs(s.cfg, r, "")
-	result, err := git.Diff(args)
+// writeDiff computes the diff for repoDir according to the request's mode and
+// writes it as JSON, with the branch's review comments anchored to it.
+// repoDir is empty in single-repo mode (git runs in CWD).
+func (s *srv) writeDiff(w http.ResponseWriter, r *http.Request, repoDir string) {
+	result, err := s.computeDiff(r, repoDir)
+	if errors.Is(err, git.ErrNoCheckpoint) {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, git.ErrInvalidRevision) {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	comments, err := git.AnchorComments(repoDir, git.CurrentBranch(repoDir), result)
+	if err != nil {
+		log.Printf("comments: %v", err)
+	}
+	result.Comments = comments
+	if err := git.ApplyViewed(repoDir, diffKey(s.cfg, r, repoDir), result); err != nil {
+		log.Printf("viewed: %v", err)
+	}
+	if err := git.MarkGenerated(repoDir, result); err != nil {
+		log.Printf("attributes: %v", err)
+	}
+	git.DescribeSubmodules(repoDir, result)
+	git.MeasureBinaries(repoDir, result)
+	if r.URL.Query().Get("highlight") == "true" {
+		git.Highlight(repoDir, result)
+	}
 	writeJSON(w, result)
 }
 
+// computeDiff returns the diff for repoDir selected by the request's mode,
+// base and untracked parameters.
+func (s *srv) computeDiff(r *http.Request, repoDir string) (*git.DiffResult, error) {
+	opts, err := diffOptions(s.cfg, r)
+	if err != nil {
+		return nil, err
+	}
+	// base and ref reach git diff as revisions, where "-" would start an option.
+	for _, key := range []string{"base", "ref"} {
+		if v := r.URL.Query().Get(key); strings.HasPrefix(v, "-") {
+			return nil, fmt.Errorf("%w %q", git.ErrInvalidRevision, v)
+		}
+	}
+	args := buildDiffArgs(s.cfg, r, repoDir)
+	if isSinceMode(s.cfg, r) {
+		// The checkpoint is a tree that includes untracked files, so compare
+		// it with a tree of the working tree rather than with the index.
+		if _, err := git.LoadCheckpoint(repoDir, git.CurrentBranch(repoDir)); err != nil {
+			return nil, err
+		}
+		tree, err := git.WorktreeTree(repoDir)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, tree)
+	}
+
+	var result *git.DiffResult
+	switch {
+	case isLayersMode(s.cfg, r):
+		result, err = git.DiffLayers(repoDir, opts)
+	case repoDir == "":
+		result, err = git.Diff(opts, args)
+	default:
+		result, err = git.DiffInRepo(repoDir, opts, args)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if wantUntracked(s.cfg, r) {
+		n := len(result.Files)
+		if err := git.AddUntracked(repoDir, result); err != nil {
+			log.Printf("untracked: %v", err)
+		}
+		if isLayersMode(s.cfg, r) {
+			for i := n; i < len(result.Files); i++ {
+				result.Files[i].Layer = git.LayerUnstaged
+				result.Files[i].Stage = git.LayerUnstaged
+			}
+		}
+	}
+	return result, nil
+}
+
 // handleWS serves the WebSocket endpoint for real-time diff refresh.
 func (s *srv) handleWS(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -362,6 +599,9 @@ func (s *srv) handleWS(w http.ResponseWriter, r *http.Request) {
 // handleDeleteBranch handles DELETE /api/branches?repo=X&branch=Y[&force=true]
 // or DELETE /api/branches?repo=X&all=true (remove all non-default branches).
 func (s *srv) handleDeleteBranch(w http.ResponseWriter, r *http.Request) {
+	if s.denyReadOnly(w) {
+		return
+	}
 	var repoDir string
 	if repoName := r.URL.Query().Get("repo"); repoName != "" {
 		dir, ok := safeRepoPath(s.cfg.WorkDir, repoName)
@@ -394,6 +634,9 @@ func (s *srv) handleDeleteBranch(w http.ResponseWriter, r *http.Request) {
 // handleDeleteWorktree handles DELETE /api/worktrees?repo=X&worktree=Y
 // or DELETE /api/worktrees?repo=X&all=true (remove all linked worktrees).
 func (s *srv) handleDeleteWorktree(w http.ResponseWriter, r *http.Request) {
+	if s.denyReadOnly(w) {
+		return
+	}
 	repoName := r.URL.Query().Get("repo")
 	if repoName == "" {
 		writeError(w, "repo parameter required", http.StatusBadRequest)
@@ -457,12 +700,121 @@ func buildDiffArgs(cfg Config, r *http.Request, repoDir string) []string {
 		}
 		return nil // plain git diff
 	case diffModeBranch:
+		if args := commitArgs(r); args != nil {
+			return args
+		}
 		return []string{base + "...HEAD"}
+	case diffModeSince:
+		return []string{git.CheckpointRef(git.CurrentBranch(repoDir))}
 	default: // diffModeAll — committed + uncommitted vs base
 		return []string{base}
 	}
 }
 
+// diffOptions returns the diff options for a request: cfg.Diff, overridden by
+// the algorithm, whitespace (all, change or none), ignoreBlankLines and
+// context query parameters where given.
+func diffOptions(cfg Config, r *http.Request) (git.DiffOptions, error) {
+	opts := cfg.Diff
+	q := r.URL.Query()
+	if q.Has("algorithm") {
+		opts.Algorithm = q.Get("algorithm")
+	}
+	if q.Has("whitespace") {
+		opts.Whitespace = q.Get("whitespace")
+		if opts.Whitespace == "none" {
+			opts.Whitespace = ""
+		}
+	}
+	if q.Has("ignoreBlankLines") {
+		opts.IgnoreBlankLines = q.Get("ignoreBlankLines") == "true"
+	}
+	if q.Has("context") {
+		n, err := strconv.Atoi(q.Get("context"))
+		if err != nil {
+			return opts, fmt.Errorf("invalid context %q", q.Get("context"))
+		}
+		opts.Context = &n
+	}
+	return opts, opts.Validate()
+}
+
+// commitArgs returns the diff arguments for the commits a branch-mode request
+// narrows the view to: commit=<hash> for one commit, or from=<hash>&to=<hash>
+// for the changes of from through to, inclusive. It returns nil when neither
+// is given or a value is not a commit hash.
+func commitArgs(r *http.Request) []string {
+	q := r.URL.Query()
+	if c := q.Get("commit"); c != "" {
+		if !git.IsCommitID(c) {
+			return nil
+		}
+		return []string{c + "^!"}
+	}
+	from, to := q.Get("from"), q.Get("to")
+	if !git.IsCommitID(from) || !git.IsCommitID(to) {
+		return nil
+	}
+	return []string{from + "^", to}
+}
+
+// diffKey names the diff the request selects — its mode and resolved
+// base/ref — for state kept per diff, such as which files were viewed.
+func diffKey(cfg Config, r *http.Request, repoDir string) string {
+	if isLayersMode(cfg, r) {
+		return diffModeLayers
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode == "" || len(cfg.RefArgs) > 0 || cfg.Staged || cfg.All {
+		mode = diffModeAll
+	}
+	return mode + " " + strings.Join(buildDiffArgs(cfg, r, repoDir), " ")
+}
+
+// isLayersMode reports whether the request asks for the staged/unstaged split.
+// CLI launch-time ref overrides take priority, as in buildDiffArgs.
+func isLayersMode(cfg Config, r *http.Request) bool {
+	if len(cfg.RefArgs) > 0 || cfg.Staged || cfg.All {
+		return false
+	}
+	return r.URL.Query().Get("mode") == diffModeLayers
+}
+
+// isSinceMode reports whether the request asks for changes since the review
+// checkpoint. CLI launch-time ref overrides take priority, as in buildDiffArgs.
+func isSinceMode(cfg Config, r *http.Request) bool {
+	if len(cfg.RefArgs) > 0 || cfg.Staged || cfg.All {
+		return false
+	}
+	return r.URL.Query().Get("mode") == diffModeSince
+}
+
+// wantUntracked reports whether untracked files belong in the diff: on by
+// default when the diff includes the working tree (uncommitted, layers and all
+// modes, --all), off for staged-only, ref and branch diffs, and off when the request
+// passes untracked=false. Since mode covers untracked files through its trees.
+func wantUntracked(cfg Config, r *http.Request) bool {
+	if r.URL.Query().Get("untracked") == "false" {
+		return false
+	}
+	if len(cfg.RefArgs) > 0 || cfg.Staged {
+		return false
+	}
+	if cfg.All {
+		return true
+	}
+	switch r.URL.Query().Get("mode") {
+	case diffModeBranch, diffModeSince:
+		return false
+	case diffModeLayers:
+		return true
+	case diffModeUncommitted:
+		return r.URL.Query().Get("staged") != "true" && r.URL.Query().Get("ref") == ""
+	default: // diffModeAll
+		return true
+	}
+}
+
 // safeRepoPath validates a repo name and returns the absolute path within workDir.
 // Repo names may contain "/" for nested repos (e.g. "meta/web") but must not
 // contain ".." components or empty segments to prevent directory traversal.
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/flatcoke/prview/internal/git"
+)
+
+// isRangeMode reports whether the request asks for a range-diff. CLI
+// launch-time ref overrides take priority, as in buildDiffArgs.
+func isRangeMode(cfg Config, r *http.Request) bool {
+	if len(cfg.RefArgs) > 0 || cfg.Staged || cfg.All {
+		return false
+	}
+	return r.URL.Query().Get("mode") == diffModeRange
+}
+
+// writeRangeDiff serves /api/diff?mode=range&old=<rev>: the commits of an
+// earlier version of the branch (old — a reflog entry, tag or hash from
+// /api/tips) compared with those of HEAD, both relative to base. The
+// DiffResult carries no files; the comparison is in its RangeDiff.
+func (s *srv) writeRangeDiff(w http.ResponseWriter, r *http.Request, repoDir string) {
+	q := r.URL.Query()
+	old := q.Get("old")
+	if old == "" {
+		writeError(w, "old parameter required", http.StatusBadRequest)
+		return
+	}
+	base := q.Get("base")
+	if base == "" {
+		base = git.DefaultBranch(repoDir)
+	}
+	rd, err := git.DiffRange(repoDir, base, old, "HEAD")
+	if errors.Is(err, git.ErrInvalidRevision) {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, &git.DiffResult{Files: []git.FileDiff{}, RangeDiff: rd})
+}
+
+// handleTips serves GET /api/tips — earlier versions of the current branch
+// (review checkpoint, unmerged tags, reflog entries) to range-diff against.
+// repo and worktree select the repository as for /api/diff.
+func (s *srv) handleTips(w http.ResponseWriter, r *http.Request) {
+	repoDir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	tips, err := git.ListTips(repoDir, git.CurrentBranch(repoDir))
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"tips": tips})
+}
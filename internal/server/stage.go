@@ -0,0 +1,146 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/flatcoke/prview/internal/git"
+)
+
+// handleStage serves POST /api/stage and POST /api/unstage.
+//
+// Query: repo, worktree (as for /api/diff), path (required), and optionally
+// hunk (index within the file's diff) with hash (the hunk's hash as the
+// client saw it, required with hunk) and from/to (inclusive indices into the
+// hunk's lines). Without hunk the whole file is staged or unstaged.
+//
+// The hunk is looked up in the file's current unstaged (stage) or staged
+// (unstage) diff; if it no longer matches, 409 is returned and nothing changes.
+// The index write triggers a WebSocket refresh through the watcher.
+func (s *srv) handleStage(unstage bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		}
+		if s.denyReadOnly(w) {
+			return
+		}
+		dir, ok := s.diffDir(w, r)
+		if !ok {
+			return
+		}
+		ref, wholeFile, err := hunkRefFromQuery(s.cfg, r)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case wholeFile && unstage:
+			err = git.UnstageFile(dir, ref.Path)
+		case wholeFile:
+			err = git.StageFile(dir, ref.Path)
+		case unstage:
+			err = git.UnstageHunk(dir, ref)
+		default:
+			err = git.StageHunk(dir, ref)
+		}
+		if err != nil {
+			writeGitError(w, err)
+			return
+		}
+		if unstage {
+			writeJSON(w, map[string]string{"ok": "unstaged"})
+		} else {
+			writeJSON(w, map[string]string{"ok": "staged"})
+		}
+	}
+}
+
+// handleDiscard serves POST /api/discard — reverts a file or hunk of the
+// working tree's unstaged changes. Query parameters are as for /api/stage.
+// Untracked files are deleted. The repo's dirty state is snapshotted first;
+// the response carries the snapshot so the client can offer an undo via
+// POST /api/snapshots?id=<id>&path=<path>.
+func (s *srv) handleDiscard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.denyReadOnly(w) {
+		return
+	}
+	dir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	ref, wholeFile, err := hunkRefFromQuery(s.cfg, r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var snap *git.Snapshot
+	if wholeFile {
+		snap, err = git.DiscardFile(dir, ref.Path)
+	} else {
+		snap, err = git.DiscardHunk(dir, ref)
+	}
+	if err != nil {
+		writeGitError(w, err)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"ok": "discarded", "snapshot": snap})
+}
+
+// hunkRefFromQuery reads path, hunk, hash, from and to. wholeFile is true
+// when no hunk was given.
+func hunkRefFromQuery(cfg Config, r *http.Request) (ref git.HunkRef, wholeFile bool, err error) {
+	q := r.URL.Query()
+	ref.Path = q.Get("path")
+	if ref.Path == "" {
+		return ref, false, fmt.Errorf("path parameter required")
+	}
+	if q.Get("hunk") == "" {
+		return ref, true, nil
+	}
+	if ref.Index, err = strconv.Atoi(q.Get("hunk")); err != nil {
+		return ref, false, fmt.Errorf("invalid hunk")
+	}
+	if ref.Hash = q.Get("hash"); ref.Hash == "" {
+		return ref, false, fmt.Errorf("hash parameter required with hunk")
+	}
+	if ref.Options, err = diffOptions(cfg, r); err != nil {
+		return ref, false, err
+	}
+	if q.Get("from") != "" || q.Get("to") != "" {
+		var lr git.LineRange
+		if lr.From, err = strconv.Atoi(q.Get("from")); err != nil {
+			return ref, false, fmt.Errorf("invalid from")
+		}
+		if lr.To, err = strconv.Atoi(q.Get("to")); err != nil {
+			return ref, false, fmt.Errorf("invalid to")
+		}
+		if lr.To < lr.From {
+			return ref, false, fmt.Errorf("to must not be less than from")
+		}
+		ref.Lines = &lr
+	}
+	return ref, false, nil
+}
+
+// writeGitError maps stale-hunk errors to 409 Conflict and everything else to 500.
+func writeGitError(w http.ResponseWriter, err error) {
+	if errors.Is(err, git.ErrStaleHunk) {
+		writeError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, git.ErrWhitespaceHunk) {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeError(w, err.Error(), http.StatusInternalServerError)
+}
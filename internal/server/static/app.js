@@ -5,14 +5,38 @@
 
   /** API endpoint paths. */
   const API = {
-    diff:      "/api/diff",
-    repos:     "/api/repos",
-    branches:  "/api/branches",
-    worktrees: "/api/worktrees",
-    clear:     "/api/clear",
-    hide:      "/api/hide",
+    config:     "/api/config",
+    diff:       "/api/diff",
+    repos:      "/api/repos",
+    branches:   "/api/branches",
+    worktrees:  "/api/worktrees",
+    clear:      "/api/clear",
+    snapshots:  "/api/snapshots",
+    stage:      "/api/stage",
+    unstage:    "/api/unstage",
+    discard:    "/api/discard",
+    comments:   "/api/comments",
+    export:     "/api/comments/export",
+    viewed:     "/api/viewed",
+    checkpoint: "/api/checkpoint",
+    commits:    "/api/commits",
+    tips:       "/api/tips",
+    context:    "/api/context",
+    file:       "/api/file",
+    blob:       "/api/blob",
+    imageDiff:  "/api/imagediff",
+    hide:       "/api/hide",
   };
 
+  /** File names the image view can show, matching the server's imageTypes. */
+  const IMAGE_FILE = /\.(png|jpe?g|gif|svg|webp)$/i;
+
+  /** Image formats the server can compute a pixel difference for. */
+  const RASTER_FILE = /\.(png|jpe?g|gif|webp)$/i;
+
+  /** Lines revealed per click on a context expand button. */
+  const EXPAND_STEP = 20;
+
   /** WebSocket reconnect backoff parameters (milliseconds). */
   const WS_RECONNECT = {
     initialDelay: 1000,
@@ -42,14 +66,35 @@
     btnModeBranch:        "btn-mode-branch",
     btnModeAll:           "btn-mode-all",
     btnModeUncommitted:   "btn-mode-uncommitted",
+    btnModeLayers:        "btn-mode-layers",
+    btnModeSince:         "btn-mode-since",
+    btnModeRange:         "btn-mode-range",
+    tipSelect:            "tip-select",
+    btnCheckpoint:        "btn-checkpoint",
+    exportSelect:         "export-select",
+    btnDiffOptions:       "btn-diff-options",
+    diffOptionsMenu:      "diff-options-menu",
+    optAlgorithm:         "opt-algorithm",
+    optWhitespace:        "opt-whitespace",
+    optBlankLines:        "opt-blank-lines",
+    optContext:           "opt-context",
+    optHighlight:         "opt-highlight",
     liveDot:              "live-dot",
     btnUnified:           "btn-unified",
     btnSplit:             "btn-split",
     sidebar:              "sidebar",
+    commitSection:        "commit-section",
+    commitList:           "commit-list",
     diffContainer:        "diff-container",
     repoListContainer:    "repo-list-container",
     fileList:             "file-list",
     loading:              "loading",
+    snapshotModal:        "snapshot-modal",
+    snapshotTitle:        "snapshot-title",
+    snapshotList:         "snapshot-list",
+    btnSnapshotClose:     "btn-snapshot-close",
+    btnSnapshotPurgeAll:  "btn-snapshot-purge-all",
+    toast:                "toast",
   };
 
   // ── State ──
@@ -62,10 +107,22 @@
   let currentBranch         = null;
   let reposCache            = null;
   let currentBase           = null;
-  let currentMode           = "all"; // "branch" | "all" | "uncommitted"
+  let currentMode           = "all"; // "branch" | "all" | "uncommitted" | "layers" | "since" | "range"
+  let currentCommits        = {}; // branch mode: {} for all commits, { commit } or { from, to }
+  let currentOld            = null; // range mode: the earlier branch version compared with HEAD
   let currentWorktrees      = []; // cached for dropdown re-render
   let currentWorktreeIsMain = false;
 
+  /** Destructive actions the server permits — replaced from /api/config at init. */
+  let capabilities = { clear: true, deleteBranch: true, deleteWorktree: true, snapshots: true, stage: true, discard: true };
+
+  /** Diff options the server uses unless a request overrides them — from /api/config at init. */
+  let defaultDiffOptions = { algorithm: "", whitespace: "", ignoreBlankLines: false, context: 3 };
+  /** Current diff options; those differing from the defaults are sent with every request. */
+  let diffOptions = { ...defaultDiffOptions };
+  /** Whether diff lines are syntax highlighted by the server. */
+  let highlight = false;
+
   /** Active WebSocket manager — holds the current live connection. */
   let wsManager = null;
 
@@ -94,16 +151,73 @@
     const worktreeName = params.get("worktree") || null;
     const base         = params.get("base") || null;
     const mode         = params.get("mode") || "all";
+    const commits      = commitSelection(params);
+    const old          = params.get("old") || null;
+    const options      = diffOptionsFrom(params);
 
     // /repos/{repoName}/branches/{currentBranch}
     const bm = pathname.match(/^\/repos\/(.+)\/branches\/([^/]+)$/);
-    if (bm) return { repoName: bm[1], worktreeName, base, mode, branch: bm[2] };
+    if (bm) return { repoName: bm[1], worktreeName, base, mode, commits, old, options, branch: bm[2] };
 
     // /repos/{repoName}
     const m = pathname.match(/^\/repos\/(.+)$/);
-    if (m) return { repoName: m[1], worktreeName, base, mode, branch: null };
+    if (m) return { repoName: m[1], worktreeName, base, mode, commits, old, options, branch: null };
+
+    return { repoName: null, worktreeName, base, mode, commits, old, options, branch: null };
+  }
 
-    return { repoName: null, worktreeName, base, mode, branch: null };
+  /** diffOptionsFrom reads diff options from query parameters over the defaults. */
+  function diffOptionsFrom(params) {
+    const options = { ...defaultDiffOptions };
+    if (params.has("algorithm"))        options.algorithm = params.get("algorithm");
+    if (params.has("whitespace"))       options.whitespace = params.get("whitespace") === "none" ? "" : params.get("whitespace");
+    if (params.has("ignoreBlankLines")) options.ignoreBlankLines = params.get("ignoreBlankLines") === "true";
+    if (params.has("context"))          options.context = contextParam(params.get("context"));
+    return options;
+  }
+
+  /** contextParam parses a context query value, which may be 0, falling back to the default. */
+  function contextParam(value) {
+    const n = parseInt(value, 10);
+    return n >= 0 && n <= 1000 ? n : defaultDiffOptions.context;
+  }
+
+  /** setDiffOptionParams adds the diff options that differ from the server's defaults to params. */
+  function setDiffOptionParams(params) {
+    const o = diffOptions, d = defaultDiffOptions;
+    if (o.algorithm !== d.algorithm)               params.set("algorithm", o.algorithm);
+    if (o.whitespace !== d.whitespace)             params.set("whitespace", o.whitespace || "none");
+    if (o.ignoreBlankLines !== d.ignoreBlankLines) params.set("ignoreBlankLines", String(o.ignoreBlankLines));
+    if (o.context !== d.context)                   params.set("context", String(o.context));
+  }
+
+  /** ignoresWhitespace reports whether diffs hide changes, so their hunks cannot be applied. */
+  function ignoresWhitespace() {
+    return diffOptions.whitespace !== "" || diffOptions.ignoreBlankLines;
+  }
+
+  /** commitSelection reads a commit or from/to range from query parameters. */
+  function commitSelection(params) {
+    if (params.get("commit")) return { commit: params.get("commit") };
+    if (params.get("from") && params.get("to")) return { from: params.get("from"), to: params.get("to") };
+    return {};
+  }
+
+  /**
+   * setModeParams adds the mode's selection to params: the commit or commit
+   * range in branch mode, the earlier version in range mode.
+   */
+  function setModeParams(params) {
+    if (currentMode === "branch") {
+      Object.entries(currentCommits).forEach(([k, v]) => params.set(k, v));
+    } else if (currentMode === "range" && currentOld) {
+      params.set("old", currentOld);
+    }
+  }
+
+  /** modeUsesBase reports whether the current mode compares against a base branch. */
+  function modeUsesBase() {
+    return currentMode === "branch" || currentMode === "all" || currentMode === "range";
   }
 
   function buildPageURL(repoName, worktreeName) {
@@ -113,8 +227,11 @@
 
     const params = new URLSearchParams();
     if (worktreeName) params.set("worktree", worktreeName);
-    if (currentMode !== "uncommitted" && currentBase) params.set("base", currentBase);
-    if (currentMode !== "branch") params.set("mode", currentMode);
+    if (modeUsesBase() && currentBase) params.set("base", currentBase);
+    if (currentMode !== "all") params.set("mode", currentMode);
+    setModeParams(params);
+    setDiffOptionParams(params);
+    if (highlight) params.set("highlight", "true");
     const qs = params.toString() ? "?" + params.toString() : "";
     return path + qs;
   }
@@ -124,13 +241,41 @@
     if (repoName)     params.set("repo", repoName);
     if (worktreeName) params.set("worktree", worktreeName);
     params.set("mode", currentMode);
-    if (currentMode !== "uncommitted" && currentBase) params.set("base", currentBase);
+    if (modeUsesBase() && currentBase) params.set("base", currentBase);
+    setModeParams(params);
+    setDiffOptionParams(params);
+    if (highlight) params.set("highlight", "true");
     return API.diff + "?" + params.toString();
   }
 
+  /** syncDiffOptions shows the current diff options in the dropdown. */
+  function syncDiffOptions() {
+    dom.optAlgorithm.value    = diffOptions.algorithm;
+    dom.optWhitespace.value   = diffOptions.whitespace;
+    dom.optBlankLines.checked = diffOptions.ignoreBlankLines;
+    dom.optContext.value      = diffOptions.context;
+    dom.optHighlight.checked  = highlight;
+    dom.btnDiffOptions.classList.toggle("active", changedDiffOptionCount() > 0);
+  }
+
+  /** changedDiffOptionCount returns how many diff options differ from the defaults. */
+  function changedDiffOptionCount() {
+    const params = new URLSearchParams();
+    setDiffOptionParams(params);
+    return [...params.keys()].length;
+  }
+
+  /** setDiffOptions changes some diff options and re-fetches the diff. */
+  function setDiffOptions(changes) {
+    diffOptions = { ...diffOptions, ...changes };
+    syncDiffOptions();
+    updateURL(false);
+    fetchAndRenderDiff();
+  }
+
   function updateURL(push) {
     const url   = buildPageURL(currentRepo, currentWorktree);
-    const state = { repo: currentRepo, worktree: currentWorktree, base: currentBase, mode: currentMode, branch: currentBranch };
+    const state = { repo: currentRepo, worktree: currentWorktree, base: currentBase, mode: currentMode, commits: currentCommits, old: currentOld, branch: currentBranch };
     if (push) history.pushState(state, "", url);
     else      history.replaceState(state, "", url);
   }
@@ -139,13 +284,30 @@
 
   async function fetchAndRenderDiff() {
     setDiffLoading(currentRepo || "");
+    if (currentMode === "range") {
+      loadTips();
+      if (!currentOld) {
+        dom.stats.innerHTML = "";
+        dom.diffContainer.innerHTML =
+          '<div class="diff-empty">Pick an earlier version of this branch to compare with.</div>';
+        return;
+      }
+    } else {
+      dom.tipSelect.style.display = "none";
+    }
     try {
       const url = buildDiffUrl(currentRepo, currentWorktree);
       diffData = await fetchJSON(url);
+      loadCommits();
       renderStats(diffData);
       renderFileList(diffData);
       renderDiff(diffData);
     } catch (err) {
+      if (currentMode === "since" && err.message === "HTTP 404") {
+        dom.diffContainer.innerHTML =
+          '<div class="diff-empty">No review checkpoint yet. Click “Mark reviewed” to record one.</div>';
+        return;
+      }
       renderDiffError(err.message);
     }
   }
@@ -229,10 +391,12 @@
 
   /** refreshDiff re-fetches the current diff without touching UI chrome. */
   async function refreshDiff() {
+    if (currentMode === "range" && !currentOld) return;
     try {
       const url  = buildDiffUrl(currentRepo, currentWorktree);
       const data = await fetchJSON(url);
       diffData = data;
+      loadCommits();
       renderStats(data);
       renderFileList(data);
       renderDiff(data);
@@ -273,7 +437,8 @@
     });
     dom.baseSelect.value    = selectedBranch || "";
     dom.baseSelect.onchange = () => {
-      currentBase = dom.baseSelect.value;
+      currentBase    = dom.baseSelect.value;
+      currentCommits = {};
       updateDeleteBranchVisibility();
       updateURL(false);
       fetchAndRenderDiff();
@@ -282,6 +447,12 @@
 
   // ── Delete handlers ──
 
+  /** applyCapabilities hides controls for actions the server does not permit. */
+  function applyCapabilities() {
+    dom.btnDeleteBranch.style.display   = capabilities.deleteBranch ? "" : "none";
+    dom.btnDeleteWorktree.style.display = capabilities.deleteWorktree ? "" : "none";
+  }
+
   function updateDeleteBranchVisibility() {
     if (!dom.btnDeleteBranch) return;
     const selected    = dom.baseSelect ? dom.baseSelect.value : "";
@@ -367,10 +538,13 @@
     dom.btnModeBranch.classList.toggle("active", currentMode === "branch");
     dom.btnModeAll.classList.toggle("active", currentMode === "all");
     dom.btnModeUncommitted.classList.toggle("active", currentMode === "uncommitted");
-    if (currentMode === "uncommitted") {
-      hideBranchControl();
-    } else {
+    dom.btnModeLayers.classList.toggle("active", currentMode === "layers");
+    dom.btnModeSince.classList.toggle("active", currentMode === "since");
+    dom.btnModeRange.classList.toggle("active", currentMode === "range");
+    if (modeUsesBase()) {
       showBranchControl();
+    } else {
+      hideBranchControl();
     }
   }
 
@@ -560,10 +734,16 @@
         `<td class="repo-status">${repo.dirty ? "Changes" : "Clean"}</td>` +
         `<td class="repo-actions"><button class="repo-menu-btn" title="Actions">⋯</button>` +
         `<div class="repo-menu">` +
-        `<button class="repo-menu-item" data-action="clear" data-repo="${repo.name}">Clear changes</button>` +
-        `<button class="repo-menu-item danger" data-action="remove-worktrees" data-repo="${repo.name}">Remove all worktrees</button>` +
-        `<button class="repo-menu-item danger" data-action="remove-branches" data-repo="${repo.name}">Remove all branches</button>` +
-        `<div class="repo-menu-divider"></div>` +
+        (capabilities.clear
+          ? `<button class="repo-menu-item" data-action="clear" data-repo="${repo.name}">Clear changes</button>` : "") +
+        (capabilities.deleteWorktree
+          ? `<button class="repo-menu-item danger" data-action="remove-worktrees" data-repo="${repo.name}">Remove all worktrees</button>` : "") +
+        (capabilities.deleteBranch
+          ? `<button class="repo-menu-item danger" data-action="remove-branches" data-repo="${repo.name}">Remove all branches</button>` : "") +
+        (capabilities.snapshots
+          ? `<button class="repo-menu-item" data-action="snapshots" data-repo="${repo.name}">Cleared snapshots…</button>` : "") +
+        (capabilities.clear || capabilities.deleteWorktree || capabilities.deleteBranch || capabilities.snapshots
+          ? `<div class="repo-menu-divider"></div>` : "") +
         `<button class="repo-menu-item danger" data-action="hide" data-repo="${repo.name}">Hide this repo</button>` +
         `</div></td>`;
 
@@ -592,7 +772,7 @@
         menu.classList.remove("open");
 
         if (action === "clear") {
-          if (!confirm(`Clear all changes in "${repoName}"? This will discard uncommitted modifications.`)) return;
+          if (!confirm(`Clear all changes in "${repoName}"? Uncommitted modifications are discarded; a snapshot is kept under "Cleared snapshots…".`)) return;
           fadeOutRow(tr);
           try {
             await repoActionAndReload(`${API.clear}?repo=${encodeURIComponent(repoName)}`, "POST");
@@ -607,6 +787,8 @@
           try {
             await repoActionAndReload(`${API.branches}?repo=${encodeURIComponent(repoName)}&all=true`, "DELETE");
           } catch (err) { alert("Error: " + err.message); }
+        } else if (action === "snapshots") {
+          openSnapshots(repoName);
         } else if (action === "hide") {
           if (!confirm(`Hide "${repoName}" from the workspace list?`)) return;
           fadeOutRow(tr);
@@ -665,12 +847,115 @@
     return true;
   }
 
+  // ── Snapshots (changes saved by "Clear changes") ──
+
+  let snapshotRepo = null;
+
+  function snapshotURL(repoName, extra) {
+    const params = new URLSearchParams(extra || {});
+    if (repoName) params.set("repo", repoName);
+    return API.snapshots + "?" + params.toString();
+  }
+
+  async function openSnapshots(repoName) {
+    snapshotRepo = repoName;
+    dom.snapshotTitle.textContent = `Cleared snapshots — ${repoName}`;
+    dom.snapshotModal.classList.add("open");
+    await renderSnapshots();
+  }
+
+  function closeSnapshots() {
+    dom.snapshotModal.classList.remove("open");
+    snapshotRepo = null;
+  }
+
+  async function renderSnapshots() {
+    dom.snapshotList.innerHTML = "";
+    let snapshots = [];
+    try {
+      const data = await fetchJSON(snapshotURL(snapshotRepo));
+      snapshots = data.snapshots || [];
+    } catch (err) {
+      dom.snapshotList.innerHTML = `<li class="snapshot-empty">Error: ${err.message}</li>`;
+      return;
+    }
+    dom.btnSnapshotPurgeAll.style.display = snapshots.length ? "" : "none";
+    if (snapshots.length === 0) {
+      dom.snapshotList.innerHTML = '<li class="snapshot-empty">No snapshots.</li>';
+      return;
+    }
+    snapshots.forEach((snap) => {
+      const li = document.createElement("li");
+
+      const info = document.createElement("div");
+      info.className = "snapshot-info";
+      const time = document.createElement("div");
+      time.className   = "snapshot-time";
+      time.textContent = new Date(snap.time * 1000).toLocaleString();
+      const msg = document.createElement("div");
+      msg.className   = "snapshot-msg";
+      msg.textContent = snap.message;
+      msg.title       = snap.commit;
+      info.appendChild(time);
+      info.appendChild(msg);
+
+      const restore = document.createElement("button");
+      restore.className   = "repo-menu-item";
+      restore.textContent = "Restore";
+      restore.onclick     = () => snapshotAction("POST", { id: snap.id }, null);
+
+      const purge = document.createElement("button");
+      purge.className   = "repo-menu-item danger";
+      purge.textContent = "Purge";
+      purge.onclick     = () => snapshotAction("DELETE", { id: snap.id },
+        "Permanently delete this snapshot? Its changes cannot be recovered afterwards.");
+
+      li.appendChild(info);
+      li.appendChild(restore);
+      li.appendChild(purge);
+      dom.snapshotList.appendChild(li);
+    });
+  }
+
+  async function snapshotAction(method, params, confirmText) {
+    if (confirmText && !confirm(confirmText)) return;
+    const repoName = snapshotRepo;
+    try {
+      const resp = await fetch(snapshotURL(repoName, params), { method });
+      if (!resp.ok) {
+        const data = await resp.json();
+        alert("Failed: " + (data.error || resp.statusText));
+        return;
+      }
+      if (method === "POST") {
+        closeSnapshots();
+        if (reposCache) {
+          const freshData = await fetchJSON(API.repos);
+          if (freshData.repos) {
+            reposCache   = freshData.repos;
+            lastRepoData = freshData;
+            renderRepoListPage(freshData.repos, false, freshData);
+          }
+        }
+        return;
+      }
+      await renderSnapshots();
+    } catch (err) {
+      alert("Error: " + err.message);
+    }
+  }
+
   // ── Repo diff ──
 
-  /** selectRepo loads a repo diff view. initialBase/initialMode come from URL or popstate. */
-  async function selectRepo(repoName, initialWorktree, initialBase, initialMode) {
+  /**
+   * selectRepo loads a repo diff view. initialBase/initialMode/initialCommits/
+   * initialOld come from URL or popstate.
+   */
+  async function selectRepo(repoName, initialWorktree, initialBase, initialMode, initialCommits, initialOld) {
     currentRepo     = repoName;
     currentWorktree = null;
+    currentCommits  = initialCommits || {};
+    currentOld      = initialOld || null;
     if (initialMode) currentMode = initialMode;
 
     showDiffView();
@@ -715,7 +1000,7 @@
 
     // Push history with fully resolved state.
     history.pushState(
-      { repo: repoName, worktree: currentWorktree, base: currentBase, mode: currentMode },
+      { repo: repoName, worktree: currentWorktree, base: currentBase, mode: currentMode, commits: currentCommits, old: currentOld },
       "",
       buildPageURL(repoName, currentWorktree)
     );
@@ -731,7 +1016,7 @@
     }
 
     history.pushState(
-      { repo: repoName, worktree: worktreeName, base: currentBase, mode: currentMode },
+      { repo: repoName, worktree: worktreeName, base: currentBase, mode: currentMode, commits: currentCommits, old: currentOld },
       "",
       buildPageURL(repoName, worktreeName)
     );
@@ -752,14 +1037,191 @@
     dom.diffContainer.innerHTML = `<div class="diff-error">Error: ${message}</div>`;
   }
 
+  // ── Branch commits ──
+
+  /**
+   * loadCommits lists the branch's commits in the sidebar in branch mode.
+   * Clicking one narrows the diff to it; shift-click selects the range from
+   * the selected commit to the clicked one.
+   */
+  async function loadCommits() {
+    if (currentMode !== "branch") {
+      dom.commitSection.style.display = "none";
+      return;
+    }
+    const query = repoQuery({});
+    if (currentBase) query.set("base", currentBase);
+    let commits = [];
+    try {
+      commits = (await fetchJSON(API.commits + "?" + query.toString())).commits || [];
+    } catch (_) {}
+    dom.commitSection.style.display = commits.length ? "" : "none";
+    renderCommitList(commits);
+  }
+
+  function renderCommitList(commits) {
+    dom.commitList.innerHTML = "";
+    const hashes   = commits.map((c) => c.hash);
+    const indexOf  = (h) => h ? hashes.findIndex((x) => x.startsWith(h)) : -1;
+    let lo = indexOf(currentCommits.commit || currentCommits.from);
+    let hi = indexOf(currentCommits.commit || currentCommits.to);
+
+    const all = document.createElement("li");
+    all.className   = "commit-all" + (lo < 0 ? " active" : "");
+    all.textContent = `All ${commits.length} commits`;
+    all.onclick     = () => selectCommits({});
+    dom.commitList.appendChild(all);
+
+    commits.forEach((c, idx) => {
+      const li = document.createElement("li");
+      if (lo >= 0 && idx >= lo && idx <= hi) li.classList.add("active");
+      li.title = `${c.author} · ${new Date(c.date * 1000).toLocaleString()}` + (c.body ? `\n\n${c.body}` : "");
+      const hash = document.createElement("span");
+      hash.className   = "commit-hash";
+      hash.textContent = c.shortHash;
+      const subject = document.createElement("span");
+      subject.className   = "commit-subject";
+      subject.textContent = c.subject;
+      const stats = document.createElement("span");
+      stats.className = "file-stats";
+      stats.innerHTML = `<span class="add">+${c.additions}</span> <span class="del">-${c.deletions}</span>`;
+      li.append(hash, subject, stats);
+      li.onclick = (e) => {
+        if (e.shiftKey && lo >= 0 && lo === hi && idx !== lo) {
+          const [a, b] = idx < lo ? [idx, lo] : [lo, idx];
+          selectCommits({ from: hashes[a], to: hashes[b] });
+        } else {
+          selectCommits({ commit: c.hash });
+        }
+      };
+      dom.commitList.appendChild(li);
+    });
+  }
+
+  function selectCommits(selection) {
+    currentCommits = selection;
+    updateURL(true);
+    fetchAndRenderDiff();
+  }
+
+  // ── Range-diff ──
+
+  /** RANGE_STATUS maps range-diff statuses to git's markers and labels. */
+  const RANGE_STATUS = {
+    unchanged: { mark: "=", label: "unchanged" },
+    modified:  { mark: "!", label: "modified" },
+    added:     { mark: ">", label: "added" },
+    dropped:   { mark: "<", label: "dropped" },
+  };
+
+  /** loadTips fills the version picker with earlier versions of the branch. */
+  async function loadTips() {
+    dom.tipSelect.style.display = "";
+    let tips = [];
+    try {
+      tips = (await fetchJSON(API.tips + "?" + repoQuery({}).toString())).tips || [];
+    } catch (_) {}
+    dom.tipSelect.innerHTML = "";
+    const placeholder = document.createElement("option");
+    placeholder.value       = "";
+    placeholder.textContent = tips.length ? "Compare with…" : "No earlier versions";
+    dom.tipSelect.appendChild(placeholder);
+    tips.forEach((tip) => {
+      const opt = document.createElement("option");
+      opt.value       = tip.rev;
+      opt.textContent = `${tip.kind}: ${tip.label} (${tip.hash.slice(0, 7)})`;
+      dom.tipSelect.appendChild(opt);
+    });
+    if (currentOld && !tips.some((tip) => tip.rev === currentOld)) {
+      const opt = document.createElement("option");
+      opt.value       = currentOld;
+      opt.textContent = currentOld;
+      dom.tipSelect.appendChild(opt);
+    }
+    dom.tipSelect.value = currentOld || "";
+  }
+
+  function renderRangeStats(rd) {
+    const count = (status) => rd.commits.filter((c) => c.status === status).length;
+    dom.stats.innerHTML =
+      `${rd.commits.length} commit${rd.commits.length !== 1 ? "s" : ""} &nbsp;` +
+      `${count("modified")} modified &nbsp;` +
+      `<span class="add">${count("added")} added</span> &nbsp;` +
+      `<span class="del">${count("dropped")} dropped</span>`;
+  }
+
+  /** renderRangeDiff lists the commit pairs with the interdiff of each modified one. */
+  function renderRangeDiff(rd) {
+    dom.diffContainer.innerHTML = "";
+    if (!rd.commits.length) {
+      dom.diffContainer.innerHTML = '<div class="diff-empty">No commits in either version.</div>';
+      return;
+    }
+    rd.commits.forEach((c) => {
+      const status = RANGE_STATUS[c.status] || { mark: "?", label: c.status };
+      const box = document.createElement("div");
+      box.className = `range-commit range-${c.status}`;
+
+      const header = document.createElement("div");
+      header.className = "range-commit-header";
+      const mark = document.createElement("span");
+      mark.className   = "range-mark";
+      mark.title       = status.label;
+      mark.textContent = status.mark;
+      const oldRef = document.createElement("span");
+      oldRef.className   = "commit-hash";
+      oldRef.textContent = c.oldHash ? `${c.oldIndex}: ${c.oldHash}` : "-";
+      const newRef = document.createElement("span");
+      newRef.className   = "commit-hash";
+      newRef.textContent = c.newHash ? `${c.newIndex}: ${c.newHash}` : "-";
+      const subject = document.createElement("span");
+      subject.className   = "commit-subject";
+      subject.textContent = c.subject;
+      header.append(mark, oldRef, newRef, subject);
+      box.appendChild(header);
+
+      if (c.interdiff) {
+        const pre = document.createElement("pre");
+        pre.className = "range-interdiff";
+        c.interdiff.split("\n").forEach((line) => {
+          const span = document.createElement("span");
+          if (line.startsWith("+"))       span.className = "add";
+          else if (line.startsWith("-"))  span.className = "del";
+          else if (line.startsWith("@@")) span.className = "hunk";
+          span.textContent = line + "\n";
+          pre.appendChild(span);
+        });
+        box.appendChild(pre);
+      }
+      dom.diffContainer.appendChild(box);
+    });
+  }
+
   // ── Stats / file list / diff rendering ──
 
   function renderStats(data) {
+    if (data.rangeDiff) {
+      renderRangeStats(data.rangeDiff);
+      return;
+    }
     const nFiles = data.files ? data.files.length : 0;
     dom.stats.innerHTML =
       `${nFiles} file${nFiles !== 1 ? "s" : ""} changed &nbsp;` +
       `<span class="add">+${data.additions || 0}</span> &nbsp;` +
-      `<span class="del">-${data.deletions || 0}</span>`;
+      `<span class="del">-${data.deletions || 0}</span>` +
+      (nFiles ? ` &nbsp;<span class="viewed-count">${data.viewedFiles || 0}/${data.totalFiles || nFiles} viewed</span>` : "") +
+      (data.collapsedFiles
+        ? ` &nbsp;<span class="collapsed-count" title="Generated, vendored and -diff files, included in the totals">` +
+          `${data.collapsedFiles} generated (+${data.collapsedAdditions || 0} -${data.collapsedDeletions || 0})</span>`
+        : "");
+  }
+
+  /** collapseReason names why a file is collapsed by default, or returns "". */
+  function collapseReason(file) {
+    if (file.generated) return "generated";
+    if (file.vendored)  return "vendored";
+    if (file.noDiff)    return "no diff";
+    return "";
   }
 
   function renderFileList(data) {
@@ -769,18 +1231,25 @@
     data.files.forEach((file, idx) => {
       const li   = document.createElement("li");
       li.onclick = () => scrollToFile(idx);
+      if (file.viewed) li.classList.add("viewed");
+      const reason = collapseReason(file);
+      if (reason) li.classList.add("generated");
 
       const name =
-        file.status === "renamed"
+        file.status === "renamed" || file.status === "copied"
           ? `${file.oldName} → ${file.newName}`
           : file.status === "deleted"
             ? file.oldName
             : file.newName;
 
-      const badgeText = file.status.charAt(0).toUpperCase();
+      const badgeText  = file.untracked ? "U" : file.status.charAt(0).toUpperCase();
+      const badgeClass = file.untracked ? "untracked" : file.status;
+      const badgeTitle = file.untracked ? "untracked" : file.status;
       li.innerHTML =
-        `<span class="status-badge status-${file.status}">${badgeText}</span>` +
+        `<span class="status-badge status-${badgeClass}" title="${badgeTitle}">${badgeText}</span>` +
         `<span class="filename" title="${name}">${name}</span>` +
+        (file.layer ? `<span class="layer-tag layer-${file.layer}">${file.layer}</span>` : "") +
+        (reason ? `<span class="layer-tag generated-tag">${reason}</span>` : "") +
         `<span class="file-stats">` +
         (file.additions ? `<span class="add">+${file.additions}</span> ` : "") +
         (file.deletions ? `<span class="del">-${file.deletions}</span>` : "") +
@@ -791,6 +1260,10 @@
   }
 
   function renderDiff(data) {
+    if (data.rangeDiff) {
+      renderRangeDiff(data.rangeDiff);
+      return;
+    }
     if (!data.rawDiff || data.rawDiff.trim() === "") {
       dom.diffContainer.innerHTML = '<div class="diff-empty">No changes detected.</div>';
       return;
@@ -803,6 +1276,7 @@
       colorScheme:  "dark",
     });
     dom.diffContainer.innerHTML = html;
+    applyHighlighting(data);
 
     dom.diffContainer.querySelectorAll(".d2h-file-header").forEach((header, idx) => {
       header.id = `file-header-${idx}`;
@@ -815,6 +1289,1057 @@
       };
       header.prepend(btn);
     });
+
+    addStageControls(data);
+    addExpandControls(data);
+    addFullFileControls(data);
+    addImageControls(data);
+    addCommentControls(data);
+    addViewedControls(data);
+    addFileMetadata(data);
+    collapseGenerated(data);
+  }
+
+  /**
+   * fileMetaTags describes what a diff of file's content does not show: mode
+   * changes, similarity, symlink targets and submodule commits.
+   */
+  function fileMetaTags(file) {
+    const tags  = [];
+    const short = (c) => c ? c.slice(0, 7) : "none";
+    if (file.oldMode && file.newMode && file.oldMode !== file.newMode) {
+      tags.push(`mode ${file.oldMode} → ${file.newMode}`);
+    }
+    if (file.similarity && (file.status === "renamed" || file.status === "copied")) {
+      tags.push(`${file.similarity}% similar`);
+    }
+    if (file.oldTarget || file.newTarget) {
+      tags.push(file.oldTarget && file.newTarget && file.oldTarget !== file.newTarget
+        ? `symlink ${file.oldTarget} → ${file.newTarget}`
+        : `symlink → ${file.newTarget || file.oldTarget}`);
+    }
+    if (file.isBinary && (file.oldSize || file.newSize)) {
+      tags.push(file.oldSize && file.newSize
+        ? `${formatBytes(file.oldSize)} → ${formatBytes(file.newSize)}`
+        : formatBytes(file.oldSize || file.newSize));
+    }
+    const sub = file.submodule;
+    if (sub) {
+      tags.push(`submodule ${short(sub.oldCommit)} → ${short(sub.newCommit)}` + (sub.dirty ? " (dirty)" : ""));
+    }
+    return tags;
+  }
+
+  /**
+   * addFileMetadata tags each file header with fileMetaTags and lists the
+   * commits a submodule moved across, when the server found them.
+   */
+  function addFileMetadata(data) {
+    const wrappers = dom.diffContainer.querySelectorAll(".d2h-file-wrapper");
+    wrappers.forEach((wrapper, idx) => {
+      const file   = data.files[idx];
+      const header = wrapper.querySelector(".d2h-file-header");
+      if (!file || !header) return;
+      let anchor = header.querySelector(".d2h-file-name-wrapper");
+      fileMetaTags(file).forEach((text) => {
+        const tag = document.createElement("span");
+        tag.className   = "layer-tag meta-tag";
+        tag.textContent = text;
+        if (anchor) anchor.after(tag);
+        else header.appendChild(tag);
+        anchor = tag;
+      });
+
+      const sub = file.submodule;
+      if (!sub || !sub.commits || !sub.commits.length) return;
+      const note = document.createElement("div");
+      note.className = "full-file-note submodule-log";
+      sub.commits.forEach((c) => {
+        const row  = note.appendChild(document.createElement("div"));
+        row.title  = `${c.author} · ${new Date(c.date * 1000).toLocaleString()}`;
+        const hash = row.appendChild(document.createElement("span"));
+        hash.className   = "commit-hash";
+        hash.textContent = c.shortHash;
+        row.append(" " + c.subject);
+      });
+      if (sub.omitted) {
+        note.appendChild(document.createElement("div")).textContent = `… and ${sub.omitted} earlier commits`;
+      }
+      header.after(note);
+    });
+  }
+
+  /**
+   * collapseGenerated tags generated, vendored and -diff files in their
+   * header and collapses them; they can still be expanded by hand.
+   */
+  function collapseGenerated(data) {
+    const wrappers = dom.diffContainer.querySelectorAll(".d2h-file-wrapper");
+    wrappers.forEach((wrapper, idx) => {
+      const file   = data.files[idx];
+      const reason = file && collapseReason(file);
+      const header = wrapper.querySelector(".d2h-file-header");
+      if (!reason || !header) return;
+      const tag = document.createElement("span");
+      tag.className   = "layer-tag generated-tag";
+      tag.textContent = reason;
+      const name = header.querySelector(".d2h-file-name-wrapper");
+      if (name) name.after(tag);
+      else header.appendChild(tag);
+      const btn = header.querySelector(".file-collapse-btn");
+      if (btn && !btn.classList.contains("collapsed")) toggleFile(btn);
+    });
+  }
+
+  // ── Syntax highlighting ──
+
+  /**
+   * applyHighlighting rebuilds the code of each diff line the server sent
+   * syntax tokens for, keeping its intra-line change marks.
+   */
+  function applyHighlighting(data) {
+    const wrappers = dom.diffContainer.querySelectorAll(".d2h-file-wrapper");
+    wrappers.forEach((wrapper, idx) => {
+      const file = data.files[idx];
+      if (!file || !file.language) return;
+      const rows = lineRows(wrapper);
+      file.hunks.forEach((hunk) => {
+        let oldNum = hunk.oldStart;
+        let newNum = hunk.newStart;
+        hunk.lines.forEach((line) => {
+          let keys;
+          if (line.type === "del")      keys = [`old:${oldNum++}`];
+          else if (line.type === "add") keys = [`new:${newNum++}`];
+          else                          keys = [`old:${oldNum++}`, `new:${newNum++}`];
+          if (!line.tokens) return;
+          keys.forEach((key) => {
+            const row = rows.get(key);
+            const ctn = row && row.tr.querySelector(".d2h-code-line-ctn");
+            if (ctn) ctn.replaceChildren(...highlightedNodes(line));
+          });
+        });
+      });
+    });
+  }
+
+  /**
+   * highlightedNodes splits a line's content at its token and change
+   * boundaries (byte offsets) into text nodes, wrapped in a span per token
+   * class and in ins/del where the line changed, as diff2html marks it.
+   */
+  function highlightedNodes(line) {
+    const bytes   = new TextEncoder().encode(line.content);
+    const decoder = new TextDecoder();
+    const tokens  = line.tokens  || [];
+    const changes = line.changes || [];
+    const cuts    = new Set([0, bytes.length]);
+    [...tokens, ...changes].forEach((s) => cuts.add(s.start).add(s.end));
+    const points = [...cuts].sort((a, b) => a - b);
+
+    const nodes = [];
+    for (let i = 0; i + 1 < points.length; i++) {
+      const from = points[i];
+      const to   = points[i + 1];
+      let node   = document.createTextNode(decoder.decode(bytes.subarray(from, to)));
+      const token = tokens.find((t) => t.start <= from && to <= t.end);
+      if (token) {
+        const span = document.createElement("span");
+        span.className = `hl-${token.class}`;
+        span.appendChild(node);
+        node = span;
+      }
+      if (changes.some((c) => c.start <= from && to <= c.end)) {
+        const mark = document.createElement(line.type === "del" ? "del" : "ins");
+        mark.appendChild(node);
+        node = mark;
+      }
+      nodes.push(node);
+    }
+    return nodes;
+  }
+
+  // ── Viewed files ──
+
+  /**
+   * addViewedControls adds a "Viewed" checkbox to each file header and
+   * collapses files already marked viewed. The server unmarks a file when its
+   * content changes, so it reappears expanded.
+   */
+  function addViewedControls(data) {
+    const wrappers = dom.diffContainer.querySelectorAll(".d2h-file-wrapper");
+    wrappers.forEach((wrapper, idx) => {
+      const file   = data.files[idx];
+      const header = wrapper.querySelector(".d2h-file-header");
+      if (!file || !header) return;
+
+      const label = document.createElement("label");
+      label.className = "viewed-toggle";
+      label.onclick   = (e) => e.stopPropagation();
+      const box = document.createElement("input");
+      box.type    = "checkbox";
+      box.checked = !!file.viewed;
+      box.onchange = () => setViewed(file, box.checked);
+      label.append(box, document.createTextNode("Viewed"));
+      header.insertBefore(label, header.querySelector(".stage-btn"));
+
+      if (file.viewed) {
+        const btn = header.querySelector(".file-collapse-btn");
+        if (btn) toggleFile(btn);
+      }
+    });
+  }
+
+  async function setViewed(file, viewed) {
+    const params = { path: filePath(file), viewed: String(viewed), mode: currentMode };
+    if (file.layer) params.layer = file.layer;
+    if (modeUsesBase() && currentBase) params.base = currentBase;
+    try {
+      const resp = await fetch(API.viewed + "?" + repoQuery(params).toString(), { method: "POST" });
+      if (!resp.ok) {
+        const data = await resp.json();
+        alert("Failed: " + (data.error || resp.statusText));
+      }
+    } catch (err) {
+      alert("Error: " + err.message);
+    }
+    refreshDiff();
+  }
+
+  // ── Context expansion ──
+
+  /**
+   * addExpandControls adds buttons that reveal the unchanged lines git left
+   * out: above each hunk (up to the previous one or the start of the file)
+   * and below the last hunk. Lines are read from the file's new side, whose
+   * blob the diff names; old line numbers follow from the hunk offsets.
+   */
+  function addExpandControls(data) {
+    const wrappers = dom.diffContainer.querySelectorAll(".d2h-file-wrapper");
+    wrappers.forEach((wrapper, idx) => {
+      const file = data.files[idx];
+      if (!file || file.isBinary || !file.hunks || !file.hunks.length) return;
+      if (!file.newBlob || /^0+$/.test(file.newBlob) || !file.oldBlob || /^0+$/.test(file.oldBlob)) return;
+
+      const tables  = [...wrapper.querySelectorAll("tbody")];
+      const headers = tables.map((tbody) =>
+        [...tbody.querySelectorAll("td.d2h-info")].filter((td) => td.textContent.trim().startsWith("@@")).map((td) => td.parentElement));
+      if (headers.some((h) => h.length !== file.hunks.length)) return;
+
+      let prevEnd = 0; // last new-side line shown by the previous hunk
+      file.hunks.forEach((hunk, i) => {
+        const gap = { from: prevEnd + 1, to: hunk.newStart - 1, offset: hunk.oldStart - hunk.newStart };
+        prevEnd = hunk.newStart + hunk.newLines - 1;
+        if (gap.to < gap.from) return;
+        const td  = headers[0][i].querySelector("td.d2h-info");
+        const btn = createExpandButton(gap, "up");
+        btn.onclick = (e) => {
+          e.stopPropagation();
+          const from = Math.max(gap.from, gap.to - EXPAND_STEP + 1);
+          expandContext(file, btn, from, gap.to, gap.offset, headers.map((h) => h[i]), () => {
+            gap.to = from - 1;
+            if (gap.to < gap.from) btn.remove();
+            else updateExpandButton(btn, gap, "up");
+          });
+        };
+        td.prepend(btn);
+      });
+
+      const last = file.hunks[file.hunks.length - 1];
+      const tail = {
+        from:   prevEnd + 1,
+        offset: last.oldStart + last.oldLines - (last.newStart + last.newLines),
+      };
+      const rows = tables.map((tbody, i) => {
+        const tr   = document.createElement("tr");
+        tr.className = "expand-row";
+        const cell = tr.appendChild(document.createElement("td"));
+        cell.colSpan = 2;
+        if (i === 0) {
+          const btn = createExpandButton(tail, "down");
+          btn.onclick = (e) => {
+            e.stopPropagation();
+            expandContext(file, btn, tail.from, tail.from + EXPAND_STEP - 1, tail.offset, rows, (lines, total) => {
+              tail.from += lines.length;
+              if (tail.from > total) rows.forEach((r) => r.remove());
+            });
+          };
+          cell.appendChild(btn);
+        }
+        tbody.appendChild(tr);
+        return tr;
+      });
+    });
+  }
+
+  function createExpandButton(gap, direction) {
+    const btn = document.createElement("button");
+    btn.className = "expand-btn";
+    updateExpandButton(btn, gap, direction);
+    return btn;
+  }
+
+  function updateExpandButton(btn, gap, direction) {
+    if (direction === "down") {
+      btn.textContent = `↓ Show ${EXPAND_STEP} more lines`;
+      return;
+    }
+    const count = gap.to - gap.from + 1;
+    btn.textContent = count <= EXPAND_STEP ? `↕ Show ${count} hidden lines` : `↑ Show ${EXPAND_STEP} more lines`;
+  }
+
+  /**
+   * expandContext fetches new-side lines from..to of file and inserts them as
+   * context rows before the anchor row of each table — one row in
+   * unified view, one per side in split view. done receives the lines and the
+   * file's line count. If the file changed since the diff, the diff reloads.
+   */
+  async function expandContext(file, btn, from, to, offset, anchors, done) {
+    btn.disabled = true;
+    try {
+      const params = { path: file.newName, blob: file.newBlob, from: String(from), to: String(to) };
+      const resp   = await fetch(API.context + "?" + repoQuery(params).toString());
+      const data   = await resp.json();
+      if (resp.status === 409) {
+        showToast("File changed — reloading the diff");
+        refreshDiff();
+        return;
+      }
+      if (!resp.ok) {
+        alert("Failed: " + (data.error || resp.statusText));
+        return;
+      }
+      const split = anchors.length === 2;
+      anchors.forEach((anchor, side) => {
+        const rows = data.lines.map((text, i) => {
+          const newNum = from + i;
+          const oldNum = newNum + offset;
+          return split
+            ? diffLineRow([side === 0 ? oldNum : newNum], text, true, "cntx")
+            : diffLineRow([oldNum, newNum], text, false, "cntx");
+        });
+        anchor.before(...rows);
+      });
+      done(data.lines, data.total);
+    } catch (err) {
+      alert("Failed: " + err.message);
+    } finally {
+      btn.disabled = false;
+    }
+  }
+
+  /** DIFF_LINE_PREFIX maps diff2html's line classes to the line prefix shown. */
+  const DIFF_LINE_PREFIX = { cntx: "\u00a0", ins: "+", del: "-" };
+
+  /**
+   * diffLineRow builds a diff row in diff2html's markup: kind is "cntx",
+   * "ins" or "del"; numbers holds one line number in split view, the old
+   * and new numbers (either may be empty) in unified view.
+   */
+  function diffLineRow(numbers, text, split, kind) {
+    const tr  = document.createElement("tr");
+    const num = tr.appendChild(document.createElement("td"));
+    num.className = (split ? "d2h-code-side-linenumber" : "d2h-code-linenumber") + " d2h-" + kind;
+    if (split) {
+      num.textContent = numbers[0];
+    } else {
+      numbers.forEach((n, i) => {
+        const div = num.appendChild(document.createElement("div"));
+        div.className   = `line-num${i + 1}`;
+        div.textContent = n;
+      });
+    }
+    const code = tr.appendChild(document.createElement("td"));
+    code.className = "d2h-" + kind;
+    const line = code.appendChild(document.createElement("div"));
+    line.className = split ? "d2h-code-side-line" : "d2h-code-line";
+    const prefix = line.appendChild(document.createElement("span"));
+    prefix.className   = "d2h-code-line-prefix";
+    prefix.textContent = DIFF_LINE_PREFIX[kind];
+    const ctn = line.appendChild(document.createElement("span"));
+    ctn.className   = "d2h-code-line-ctn";
+    ctn.textContent = text;
+    return tr;
+  }
+
+  // ── Full-file view ──
+
+  /**
+   * addFullFileControls adds a "Full file" toggle to modified files, which
+   * swaps the hunks for the whole new version of the file with the hunks
+   * overlaid. Added and deleted files already show every line.
+   */
+  function addFullFileControls(data) {
+    const wrappers = dom.diffContainer.querySelectorAll(".d2h-file-wrapper");
+    wrappers.forEach((wrapper, idx) => {
+      const file   = data.files[idx];
+      const header = wrapper.querySelector(".d2h-file-header");
+      const body   = wrapper.querySelector(".d2h-files-diff, .d2h-file-diff");
+      if (!file || !header || !body || file.isBinary || !(file.hunks || []).length) return;
+      if (file.status !== "modified" && file.status !== "renamed") return;
+
+      const btn = document.createElement("button");
+      btn.className   = "stage-btn";
+      btn.textContent = "Full file";
+      let full = null;
+      btn.onclick = async (e) => {
+        e.stopPropagation();
+        if (full) {
+          const showFull = full.style.display === "none";
+          full.style.display = showFull ? "" : "none";
+          body.style.display = showFull ? "none" : "";
+          btn.classList.toggle("active", showFull);
+          return;
+        }
+        btn.disabled = true;
+        try {
+          const content = await fetchFileContent(file, "new");
+          if (!content) return;
+          full = renderFullFile(file, content);
+          body.after(full);
+          body.style.display = "none";
+          btn.classList.add("active");
+        } finally {
+          btn.disabled = false;
+        }
+      };
+      header.appendChild(btn);
+    });
+  }
+
+  /**
+   * fileQuery returns the query naming one side of file in the current diff,
+   * for /api/file, /api/blob and /api/imagediff.
+   */
+  function fileQuery(file, side) {
+    const params = repoQuery({ path: filePath(file), side, mode: currentMode });
+    if (file.layer) params.set("layer", file.layer);
+    if (modeUsesBase() && currentBase) params.set("base", currentBase);
+    setModeParams(params);
+    return params;
+  }
+
+  /**
+   * fetchFileContent fetches one side of file as the current diff compares
+   * it. It returns null, after telling the user, for content that cannot be
+   * shown.
+   */
+  async function fetchFileContent(file, side) {
+    try {
+      const resp = await fetch(API.file + "?" + fileQuery(file, side).toString());
+      const data = await resp.json();
+      if (resp.status === 409) {
+        showToast("File changed — reloading the diff");
+        refreshDiff();
+        return null;
+      }
+      if (!resp.ok) {
+        alert("Failed: " + (data.error || resp.statusText));
+        return null;
+      }
+      if (data.binary || data.tooLarge) {
+        showToast(data.binary ? "Binary file — no text to show" : "File too large to show in full");
+        return null;
+      }
+      return data;
+    } catch (err) {
+      alert("Error: " + err.message);
+      return null;
+    }
+  }
+
+  /**
+   * renderFullFile builds a unified table of content (the file's new side)
+   * in which the lines outside file's hunks appear as context and the hunks
+   * appear as in the diff.
+   */
+  function renderFullFile(file, content) {
+    const lines = content.content.split("\n");
+    if (lines[lines.length - 1] === "") lines.pop();
+
+    const tbody = document.createElement("tbody");
+    tbody.className = "d2h-diff-tbody";
+    let newNum = 1;
+    let offset = 0; // old line number minus new line number outside hunks
+    const contextUpTo = (end) => {
+      for (; newNum <= end && newNum <= lines.length; newNum++) {
+        tbody.appendChild(diffLineRow([newNum + offset, newNum], lines[newNum - 1], false, "cntx"));
+      }
+    };
+    file.hunks.forEach((hunk) => {
+      contextUpTo(hunk.newStart - 1);
+      let oldNum = hunk.oldStart;
+      newNum     = hunk.newStart;
+      hunk.lines.forEach((l) => {
+        if (l.type === "del") {
+          tbody.appendChild(diffLineRow([oldNum++, ""], l.content, false, "del"));
+        } else if (l.type === "add") {
+          tbody.appendChild(diffLineRow(["", newNum++], l.content, false, "ins"));
+        } else {
+          tbody.appendChild(diffLineRow([oldNum++, newNum++], l.content, false, "cntx"));
+        }
+      });
+      offset = oldNum - newNum;
+    });
+    contextUpTo(lines.length);
+
+    const view = document.createElement("div");
+    view.className = "d2h-file-diff full-file";
+    const wrap  = view.appendChild(document.createElement("div"));
+    wrap.className = "d2h-code-wrapper";
+    const table = wrap.appendChild(document.createElement("table"));
+    table.className = "d2h-diff-table";
+    table.appendChild(tbody);
+    if (content.encoding && content.encoding !== "utf-8") {
+      const note = document.createElement("div");
+      note.className   = "full-file-note";
+      note.textContent = `Decoded from ${content.encoding}`;
+      view.prepend(note);
+    }
+    return view;
+  }
+
+  /** formatBytes renders a byte count for people, e.g. 1536 as "1.5 KB". */
+  function formatBytes(n) {
+    if (n < 1024) return `${n} B`;
+    const units = ["KB", "MB", "GB"];
+    let i = -1;
+    do {
+      n /= 1024;
+      i++;
+    } while (n >= 1024 && i < units.length - 1);
+    return `${n.toFixed(n < 10 ? 1 : 0)} ${units[i]}`;
+  }
+
+  // ── Image view ──
+
+  /**
+   * addImageControls shows image files as images. Binary images get the
+   * image view in place of diff2html's "binary file" note; SVGs, which git
+   * diffs as text, get an "Image" toggle next to their hunks.
+   */
+  function addImageControls(data) {
+    const wrappers = dom.diffContainer.querySelectorAll(".d2h-file-wrapper");
+    wrappers.forEach((wrapper, idx) => {
+      const file   = data.files[idx];
+      const header = wrapper.querySelector(".d2h-file-header");
+      const body   = wrapper.querySelector(".d2h-files-diff, .d2h-file-diff");
+      if (!file || !header || !IMAGE_FILE.test(filePath(file)) || file.tooLarge) return;
+
+      if (file.isBinary || !body) {
+        const view = renderImageView(file);
+        if (body) {
+          body.after(view);
+          body.style.display = "none";
+        } else {
+          header.after(view);
+        }
+        return;
+      }
+      const btn = document.createElement("button");
+      btn.className   = "stage-btn";
+      btn.textContent = "Image";
+      let view = null;
+      btn.onclick = (e) => {
+        e.stopPropagation();
+        if (!view) {
+          view = renderImageView(file);
+          view.style.display = "none";
+          body.after(view);
+        }
+        const showImage = view.style.display === "none";
+        view.style.display = showImage ? "" : "none";
+        body.style.display = showImage ? "none" : "";
+        btn.classList.toggle("active", showImage);
+      };
+      header.appendChild(btn);
+    });
+  }
+
+  /**
+   * renderImageView builds the image view of file: both versions side by
+   * side ("2-up"), overlaid with an opacity slider ("Onion skin"), or the
+   * server's pixel difference ("Difference"). Added and deleted images show
+   * their one version.
+   */
+  function renderImageView(file) {
+    const hasOld = file.oldName !== "/dev/null";
+    const hasNew = file.newName !== "/dev/null";
+    const src    = (side) => API.blob + "?" + fileQuery(file, side).toString();
+
+    const view = document.createElement("div");
+    view.className = "image-view";
+    const bar   = view.appendChild(document.createElement("div"));
+    bar.className = "image-view-modes";
+    const stage = view.appendChild(document.createElement("div"));
+    stage.className = "image-view-stage";
+
+    const figure = (side, label, size) => {
+      const fig = document.createElement("figure");
+      fig.className = `image-side image-${side}`;
+      const img = fig.appendChild(document.createElement("img"));
+      img.src = src(side);
+      img.alt = `${label} ${filePath(file)}`;
+      const caption = fig.appendChild(document.createElement("figcaption"));
+      caption.textContent = size ? `${label} · ${formatBytes(size)}` : label;
+      img.onload = () => {
+        caption.textContent += ` · ${img.naturalWidth}×${img.naturalHeight}`;
+      };
+      img.onerror = () => {
+        caption.textContent = `${label} · could not be loaded`;
+      };
+      return fig;
+    };
+
+    const modes = {
+      "2-up": () => {
+        if (hasOld) stage.appendChild(figure("old", "Before", file.oldSize));
+        if (hasNew) stage.appendChild(figure("new", "After", file.newSize));
+      },
+    };
+    if (hasOld && hasNew) {
+      modes["Onion skin"] = () => {
+        const layers = stage.appendChild(document.createElement("div"));
+        layers.className = "image-onion";
+        const before = layers.appendChild(document.createElement("img"));
+        before.src = src("old");
+        const after = layers.appendChild(document.createElement("img"));
+        after.src = src("new");
+        after.className = "image-onion-top";
+        const slider = stage.appendChild(document.createElement("input"));
+        slider.type  = "range";
+        slider.min   = "0";
+        slider.max   = "100";
+        slider.value = "50";
+        slider.title = "Before ← → After";
+        after.style.opacity = "0.5";
+        slider.oninput = () => {
+          after.style.opacity = String(slider.value / 100);
+        };
+      };
+    }
+    if (hasOld && hasNew && RASTER_FILE.test(file.oldName) && RASTER_FILE.test(file.newName)) {
+      modes["Difference"] = async () => {
+        const note = stage.appendChild(document.createElement("div"));
+        note.className   = "full-file-note";
+        note.textContent = "Comparing…";
+        try {
+          const resp = await fetch(API.imageDiff + "?" + fileQuery(file, "new").toString());
+          if (!resp.ok) {
+            const data = await resp.json().catch(() => ({}));
+            note.textContent = "Cannot compare: " + (data.error || resp.statusText);
+            return;
+          }
+          const changed = Number(resp.headers.get("X-Changed-Pixels"));
+          const img = document.createElement("img");
+          img.src = URL.createObjectURL(await resp.blob());
+          img.onload = () => URL.revokeObjectURL(img.src);
+          img.className = "image-diff";
+          note.textContent = changed
+            ? `${changed.toLocaleString()} pixel${changed !== 1 ? "s" : ""} differ (red)`
+            : "The images are identical pixel for pixel";
+          note.after(img);
+        } catch (err) {
+          note.textContent = "Cannot compare: " + err.message;
+        }
+      };
+    }
+
+    const show = (name) => {
+      stage.innerHTML = "";
+      bar.querySelectorAll("button").forEach((b) => b.classList.toggle("active", b.textContent === name));
+      modes[name]();
+    };
+    Object.keys(modes).forEach((name) => {
+      const btn = bar.appendChild(document.createElement("button"));
+      btn.className   = "stage-btn";
+      btn.textContent = name;
+      btn.onclick     = () => show(name);
+    });
+    if (Object.keys(modes).length === 1) bar.style.display = "none";
+    show("2-up");
+    return view;
+  }
+
+  // ── Hunk staging ──
+
+  /**
+   * stageActionFor returns "stage", "unstage" or null for a file in the
+   * current mode: uncommitted shows working tree vs index, so its hunks can be
+   * staged; layers mode says per file which layer a hunk belongs to.
+   */
+  function stageActionFor(file) {
+    if (!capabilities.stage) return null;
+    if (currentMode === "uncommitted") return "stage";
+    if (currentMode === "layers") return file.layer === "staged" ? "unstage" : "stage";
+    return null;
+  }
+
+  /**
+   * addStageControls adds stage/unstage buttons to file headers and hunk
+   * headers, plus discard buttons wherever the changes are unstaged.
+   */
+  function addStageControls(data) {
+    const wrappers = dom.diffContainer.querySelectorAll(".d2h-file-wrapper");
+    wrappers.forEach((wrapper, idx) => {
+      const file   = data.files[idx];
+      const action = file && stageActionFor(file);
+      if (!action) return;
+      const path  = filePath(file);
+      const label = action === "stage" ? "Stage" : "Unstage";
+      const canDiscard = action === "stage" && capabilities.discard;
+
+      const header = wrapper.querySelector(".d2h-file-header");
+      if (header) {
+        header.appendChild(createStageButton(`${label} file`, action, { path }));
+        if (canDiscard) header.appendChild(createDiscardButton("Discard file", { path }));
+      }
+
+      // The hunks of a rename or copy are against the source file, which
+      // the single-path diff behind hunk actions does not pair them with.
+      if (file.status === "renamed" || file.status === "copied") return;
+
+      // In split view both sides repeat the hunk headers; use the left side only.
+      const side = wrapper.querySelector(".d2h-file-side-diff") || wrapper;
+      let hunkIdx = 0;
+      side.querySelectorAll("td.d2h-info").forEach((td) => {
+        const text = td.textContent.trim();
+        if (!text.startsWith("@@")) return;
+        const hunk = file.hunks && file.hunks[hunkIdx];
+        // Hunks of a diff that ignores whitespace do not match the file.
+        if (hunk && !ignoresWhitespace()) {
+          const params = { path, hunk: String(hunkIdx), hash: hunk.hash };
+          td.appendChild(createStageButton(`${label} hunk`, action, params));
+          if (canDiscard) td.appendChild(createDiscardButton("Discard hunk", params));
+        }
+        hunkIdx++;
+      });
+    });
+  }
+
+  function createStageButton(text, action, params) {
+    const btn = document.createElement("button");
+    btn.className   = "stage-btn";
+    btn.textContent = text;
+    btn.onclick = async (e) => {
+      e.stopPropagation();
+      btn.disabled = true;
+      try {
+        const resp = await fetch(API[action] + "?" + repoQuery(params).toString(), { method: "POST" });
+        if (!resp.ok) {
+          const data = await resp.json();
+          alert("Failed: " + (data.error || resp.statusText));
+        }
+      } catch (err) {
+        alert("Error: " + err.message);
+      }
+      refreshDiff();
+    };
+    return btn;
+  }
+
+  /** repoQuery returns query parameters selecting the current repo and worktree. */
+  function repoQuery(params) {
+    const query = new URLSearchParams(params);
+    if (currentRepo)     query.set("repo", currentRepo);
+    if (currentWorktree) query.set("worktree", currentWorktree);
+    setDiffOptionParams(query);
+    return query;
+  }
+
+  /**
+   * createDiscardButton reverts a file or hunk in the working tree after a
+   * confirmation. The server snapshots first; a toast offers to restore the
+   * file from that snapshot.
+   */
+  function createDiscardButton(text, params) {
+    const btn = document.createElement("button");
+    btn.className   = "stage-btn danger";
+    btn.textContent = text;
+    btn.onclick = async (e) => {
+      e.stopPropagation();
+      const what = params.hunk !== undefined ? "this hunk in" : "all unstaged changes to";
+      if (!confirm(`Discard ${what} ${params.path}?`)) return;
+      btn.disabled = true;
+      try {
+        const resp = await fetch(API.discard + "?" + repoQuery(params).toString(), { method: "POST" });
+        const data = await resp.json();
+        if (!resp.ok) {
+          alert("Failed: " + (data.error || resp.statusText));
+        } else if (data.snapshot) {
+          showUndoToast(`Discarded changes in ${params.path}`, data.snapshot.id, params.path, params.hunk !== undefined);
+        }
+      } catch (err) {
+        alert("Error: " + err.message);
+      }
+      refreshDiff();
+    };
+    return btn;
+  }
+
+  let toastTimer = null;
+
+  /**
+   * showUndoToast shows message with an Undo button restoring path from a
+   * snapshot. Undo restores the whole file, so after discarding one hunk
+   * (partial) it asks first, as edits made since would be lost.
+   */
+  function showUndoToast(message, snapshotId, path, partial) {
+    const toast = dom.toast;
+    toast.innerHTML = "";
+    const text = document.createElement("span");
+    text.textContent = message;
+    const undo = document.createElement("button");
+    undo.className   = "toast-action";
+    undo.textContent = "Undo";
+    undo.onclick = async () => {
+      if (partial && !confirm(`Undo restores all of ${path} as it was before the discard, overwriting any edits made to it since. Continue?`)) return;
+      hideToast();
+      const query = repoQuery({ id: snapshotId, path });
+      try {
+        const resp = await fetch(API.snapshots + "?" + query.toString(), { method: "POST" });
+        if (!resp.ok) {
+          const data = await resp.json();
+          alert("Undo failed: " + (data.error || resp.statusText));
+        }
+      } catch (err) {
+        alert("Error: " + err.message);
+      }
+      refreshDiff();
+    };
+    toast.append(text, undo);
+    toast.classList.add("visible");
+    clearTimeout(toastTimer);
+    toastTimer = setTimeout(hideToast, 10000);
+  }
+
+  /** showToast shows a short message that hides itself. */
+  function showToast(message) {
+    dom.toast.textContent = message;
+    dom.toast.classList.add("visible");
+    clearTimeout(toastTimer);
+    toastTimer = setTimeout(hideToast, 4000);
+  }
+
+  function hideToast() {
+    clearTimeout(toastTimer);
+    dom.toast.classList.remove("visible");
+  }
+
+  // ── Review comments ──
+
+  /** filePath returns the path a file is known by on the server. */
+  function filePath(file) {
+    return file.status === "deleted" ? file.oldName : file.newName;
+  }
+
+  /**
+   * lineRows maps "side:line" to the diff row showing that line in a file
+   * wrapper. In split view the old side is the left table and the new side
+   * the right; in unified view one row carries both numbers.
+   */
+  function lineRows(wrapper) {
+    const rows  = new Map();
+    const sides = wrapper.querySelectorAll(".d2h-file-side-diff");
+    if (sides.length === 2) {
+      ["old", "new"].forEach((side, i) => {
+        sides[i].querySelectorAll("td.d2h-code-side-linenumber").forEach((td) => {
+          const n = parseInt(td.textContent, 10);
+          if (n) rows.set(`${side}:${n}`, { tr: td.parentElement, td, side });
+        });
+      });
+      return rows;
+    }
+    wrapper.querySelectorAll("td.d2h-code-linenumber").forEach((td) => {
+      const oldNum = parseInt((td.querySelector(".line-num1") || {}).textContent, 10);
+      const newNum = parseInt((td.querySelector(".line-num2") || {}).textContent, 10);
+      if (newNum) rows.set(`new:${newNum}`, { tr: td.parentElement, td, side: "new" });
+      if (oldNum) rows.set(`old:${oldNum}`, { tr: td.parentElement, td, side: oldNum && !newNum ? "old" : "new" });
+    });
+    return rows;
+  }
+
+  /**
+   * addCommentControls renders the branch's review comments below the lines
+   * they are anchored to, lists outdated ones under the file header, and
+   * lets a click on a line number open a form for a new comment.
+   */
+  function addCommentControls(data) {
+    const comments = data.comments || [];
+    const placed   = new Set();
+    const wrappers = dom.diffContainer.querySelectorAll(".d2h-file-wrapper");
+    wrappers.forEach((wrapper, idx) => {
+      const file = data.files[idx];
+      if (!file) return;
+      const path = filePath(file);
+      const rows = lineRows(wrapper);
+
+      rows.forEach((row, key) => {
+        const side = key.split(":")[0];
+        if (row.side !== side) return; // unified context rows comment on the new side
+        row.td.classList.add("commentable");
+        row.td.title = "Add a comment";
+        row.td.onclick = () => openCommentForm(wrapper, row.tr, { path, side, line: key.split(":")[1] });
+      });
+
+      const outdated = [];
+      comments.forEach((c) => {
+        if (placed.has(c.id) || (c.path !== path && c.path !== file.oldName)) return;
+        if (c.outdated) {
+          outdated.push(c);
+          placed.add(c.id);
+          return;
+        }
+        const row = rows.get(`${c.side}:${c.line}`);
+        if (!row) return;
+        insertCommentRow(wrapper, row.tr, createCommentCard(c));
+        placed.add(c.id);
+      });
+      if (outdated.length) {
+        const box = document.createElement("div");
+        box.className = "comment-outdated";
+        outdated.forEach((c) => box.appendChild(createCommentCard(c)));
+        const header = wrapper.querySelector(".d2h-file-header");
+        if (header) header.after(box);
+      }
+    });
+  }
+
+  /**
+   * insertCommentRow inserts content in a full-width row after tr. In split
+   * view an empty row is added to the other side as well, keeping both
+   * tables aligned.
+   */
+  function insertCommentRow(wrapper, tr, content) {
+    const row = document.createElement("tr");
+    row.className = "comment-row";
+    const td = document.createElement("td");
+    td.colSpan = 2;
+    td.appendChild(content);
+    row.appendChild(td);
+    const index = Array.prototype.indexOf.call(tr.parentElement.children, tr);
+    tr.after(row);
+
+    wrapper.querySelectorAll(".d2h-file-side-diff tbody").forEach((tbody) => {
+      if (tbody === tr.parentElement) return;
+      const other  = tbody.children[index];
+      const filler = document.createElement("tr");
+      filler.className = "comment-row comment-filler";
+      const cell   = filler.appendChild(document.createElement("td"));
+      cell.colSpan    = 2;
+      filler.syncWith = row;
+      if (other) other.after(filler);
+      new ResizeObserver(() => {
+        cell.style.height = row.offsetHeight + "px";
+      }).observe(row);
+    });
+    return row;
+  }
+
+  /** removeCommentRow removes a row added by insertCommentRow and its filler. */
+  function removeCommentRow(wrapper, row) {
+    wrapper.querySelectorAll(".comment-filler").forEach((f) => {
+      if (f.syncWith === row) f.remove();
+    });
+    row.remove();
+  }
+
+  function createCommentCard(c) {
+    const card = document.createElement("div");
+    card.className = "comment-card" + (c.outdated ? " outdated" : "");
+
+    const meta = document.createElement("div");
+    meta.className = "comment-meta";
+    const where = c.outdated ? `${c.path}:${c.line} (outdated) · ` : "";
+    meta.textContent = where + new Date(c.updated * 1000).toLocaleString();
+
+    const edit = document.createElement("button");
+    edit.className   = "comment-action";
+    edit.textContent = "Edit";
+    edit.onclick = async () => {
+      const text = prompt("Edit comment", c.body);
+      if (text === null || text.trim() === "" || text === c.body) return;
+      await commentRequest("PUT", { id: c.id }, text);
+    };
+    const del = document.createElement("button");
+    del.className   = "comment-action";
+    del.textContent = "Delete";
+    del.onclick = async () => {
+      if (!confirm("Delete this comment?")) return;
+      await commentRequest("DELETE", { id: c.id });
+    };
+    meta.append(edit, del);
+
+    const body = document.createElement("div");
+    body.className   = "comment-body";
+    body.textContent = c.body;
+
+    card.append(meta, body);
+    return card;
+  }
+
+  /** openCommentForm shows a form for a new comment below tr. */
+  function openCommentForm(wrapper, tr, params) {
+    const form = document.createElement("form");
+    form.className = "comment-form";
+    const input = document.createElement("textarea");
+    input.placeholder = "Leave a note on this line";
+    const cancel = document.createElement("button");
+    cancel.type        = "button";
+    cancel.className   = "comment-action";
+    cancel.textContent = "Cancel";
+    const save = document.createElement("button");
+    save.type        = "submit";
+    save.className   = "comment-action primary";
+    save.textContent = "Comment";
+    const actions = document.createElement("div");
+    actions.className = "comment-form-actions";
+    actions.append(cancel, save);
+    form.append(input, actions);
+
+    const row = insertCommentRow(wrapper, tr, form);
+    cancel.onclick = () => removeCommentRow(wrapper, row);
+    form.onsubmit = async (e) => {
+      e.preventDefault();
+      if (input.value.trim() === "") return;
+      save.disabled = true;
+      const query = { ...params, mode: currentMode };
+      if (modeUsesBase() && currentBase) query.base = currentBase;
+      await commentRequest("POST", query, input.value);
+    };
+    input.focus();
+  }
+
+  /**
+   * setupExport opens the comments export chosen in the export menu in a new
+   * tab.
+   */
+  function setupExport() {
+    dom.exportSelect.onchange = () => {
+      const format = dom.exportSelect.value;
+      dom.exportSelect.value = "";
+      if (!format) return;
+      // Forge reviews are placed on HEAD, so they are always anchored
+      // against the branch diff; Markdown follows the current view.
+      const params = format === "markdown" ? { format, mode: currentMode } : { format };
+      if ((format !== "markdown" || modeUsesBase()) && currentBase) params.base = currentBase;
+      window.open(API.export + "?" + repoQuery(params).toString(), "_blank");
+    };
+  }
+
+  /** commentRequest sends a comment API request, then refreshes the diff. */
+  async function commentRequest(method, params, body) {
+    const init = { method };
+    if (body !== undefined) init.body = new URLSearchParams({ body });
+    try {
+      const resp = await fetch(API.comments + "?" + repoQuery(params).toString(), init);
+      if (!resp.ok) {
+        const data = await resp.json();
+        alert("Failed: " + (data.error || resp.statusText));
+      }
+    } catch (err) {
+      alert("Error: " + err.message);
+    }
+    refreshDiff();
   }
 
   function toggleFile(btn) {
@@ -853,7 +2378,8 @@
   function setupModeToggle() {
     const handler = (mode) => () => {
       if (currentMode === mode) return;
-      currentMode = mode;
+      currentMode    = mode;
+      currentCommits = {};
       syncModeToggle();
       updateURL(false);
       fetchAndRenderDiff();
@@ -861,6 +2387,36 @@
     dom.btnModeBranch.onclick      = handler("branch");
     dom.btnModeAll.onclick         = handler("all");
     dom.btnModeUncommitted.onclick = handler("uncommitted");
+    dom.btnModeLayers.onclick      = handler("layers");
+    dom.btnModeSince.onclick       = handler("since");
+    dom.btnModeRange.onclick       = handler("range");
+    dom.tipSelect.onchange         = () => {
+      currentOld = dom.tipSelect.value || null;
+      updateURL(true);
+      fetchAndRenderDiff();
+    };
+    dom.btnCheckpoint.onclick      = saveCheckpoint;
+  }
+
+  /**
+   * saveCheckpoint records the working tree as reviewed; "Since review" mode
+   * then shows only what changes after this point.
+   */
+  async function saveCheckpoint() {
+    dom.btnCheckpoint.disabled = true;
+    try {
+      const resp = await fetch(API.checkpoint + "?" + repoQuery({}).toString(), { method: "POST" });
+      if (!resp.ok) {
+        const data = await resp.json();
+        alert("Failed: " + (data.error || resp.statusText));
+      } else {
+        showToast("Marked as reviewed — “Since review” now starts here");
+        if (currentMode === "since") refreshDiff();
+      }
+    } catch (err) {
+      alert("Error: " + err.message);
+    }
+    dom.btnCheckpoint.disabled = false;
   }
 
   // ── Close all open menus ──
@@ -877,9 +2433,25 @@
 
     setupViewToggle();
     setupModeToggle();
+    setupExport();
     dom.btnDeleteBranch.onclick   = deleteBranch;
     dom.btnDeleteWorktree.onclick = deleteWorktree;
 
+    try {
+      const config = await fetchJSON(API.config);
+      if (config.capabilities) capabilities = config.capabilities;
+      if (config.diffOptions) {
+        const d = config.diffOptions;
+        defaultDiffOptions = {
+          algorithm:        d.algorithm || "",
+          whitespace:       d.whitespace || "",
+          ignoreBlankLines: !!d.ignoreBlankLines,
+          context:          d.context ?? 3,
+        };
+      }
+    } catch (_) {}
+    applyCapabilities();
+
     // Worktree custom dropdown toggle.
     dom.wtBtn.onclick = (e) => {
       e.stopPropagation();
@@ -887,6 +2459,14 @@
       dom.wtMenu.classList.toggle("open");
     };
 
+    // Snapshot modal.
+    dom.btnSnapshotClose.onclick    = closeSnapshots;
+    dom.btnSnapshotPurgeAll.onclick = () => snapshotAction("DELETE", { all: "true" },
+      "Permanently delete ALL snapshots for this repo?");
+    dom.snapshotModal.onclick = (e) => {
+      if (e.target === dom.snapshotModal) closeSnapshots();
+    };
+
     // Settings dropdown toggle.
     dom.btnSettings.onclick = (e) => {
       e.stopPropagation();
@@ -910,9 +2490,35 @@
       } catch (_) {}
     };
 
+    // Diff options dropdown.
+    dom.btnDiffOptions.onclick = (e) => {
+      e.stopPropagation();
+      closeAllMenus();
+      dom.diffOptionsMenu.classList.toggle("open");
+    };
+    dom.diffOptionsMenu.onclick = (e) => e.stopPropagation();
+    dom.optAlgorithm.onchange  = () => setDiffOptions({ algorithm: dom.optAlgorithm.value });
+    dom.optWhitespace.onchange = () => setDiffOptions({ whitespace: dom.optWhitespace.value });
+    dom.optBlankLines.onchange = () => setDiffOptions({ ignoreBlankLines: dom.optBlankLines.checked });
+    dom.optHighlight.onchange  = () => {
+      highlight = dom.optHighlight.checked;
+      updateURL(false);
+      fetchAndRenderDiff();
+    };
+    dom.optContext.onchange    = () => {
+      const n = parseInt(dom.optContext.value, 10);
+      if (n >= 0 && n <= 1000) setDiffOptions({ context: n });
+      else dom.optContext.value = diffOptions.context;
+    };
+
     // Read URL state at page load.
     const urlState = parseURLState();
-    currentMode = urlState.mode || "all";
+    diffOptions    = urlState.options;
+    highlight      = new URLSearchParams(window.location.search).get("highlight") === "true";
+    syncDiffOptions();
+    currentMode    = urlState.mode || "all";
+    currentCommits = urlState.commits;
+    currentOld     = urlState.old;
     if (urlState.base) currentBase = urlState.base;
 
     dom.btnBack.onclick = () => {
@@ -923,14 +2529,16 @@
       if (e.state && e.state.repo) {
         currentBase = e.state.base || null;
         currentMode = e.state.mode || "all";
-        selectRepo(e.state.repo, e.state.worktree || null, e.state.base, e.state.mode);
+        selectRepo(e.state.repo, e.state.worktree || null, e.state.base, e.state.mode, e.state.commits, e.state.old);
       } else if (reposCache) {
         renderRepoListPage(reposCache, false);
       } else {
         // Single-repo mode: restore mode/base from URL then re-fetch.
         const state = parseURLState();
-        currentBase = state.base;
-        currentMode = state.mode || "all";
+        currentBase    = state.base;
+        currentMode    = state.mode || "all";
+        currentCommits = state.commits;
+        currentOld     = state.old;
         syncModeToggle();
         fetchAndRenderDiff();
       }
@@ -949,7 +2557,7 @@
       // Workspace mode: honour direct URL like /repos/name or /repos/name/worktrees/wt.
       const { repoName, worktreeName } = urlState;
       if (repoName && repos.some((r) => r.name === repoName)) {
-        await selectRepo(repoName, worktreeName, urlState.base, urlState.mode);
+        await selectRepo(repoName, worktreeName, urlState.base, urlState.mode, urlState.commits, urlState.old);
       } else {
         renderRepoListPage(repos, false);
       }
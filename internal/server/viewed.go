@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/flatcoke/prview/internal/git"
+)
+
+// handleViewed serves POST /api/viewed?path=&viewed=true|false — marks or
+// unmarks a file as viewed in the diff selected by the request's diff
+// parameters (mode, base, ...), as for /api/diff. In layers mode, layer names
+// which entry of the path is meant. Like comments, viewed state is local and
+// stays available in read-only mode.
+func (s *srv) handleViewed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	dir, ok := s.diffDir(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("path") == "" {
+		writeError(w, "path parameter required", http.StatusBadRequest)
+		return
+	}
+	result, err := s.computeDiff(r, dir)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	mark := q.Get("viewed") != "false"
+	if err := git.SetViewed(dir, diffKey(s.cfg, r, dir), result, q.Get("path"), q.Get("layer"), mark); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, map[string]bool{"viewed": mark})
+}
@@ -0,0 +1,132 @@
+package watcher
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// gitMeta describes the git metadata directories backing a working tree.
+// For a regular repo both fields point at <dir>/.git. For a linked worktree
+// or submodule, .git is a file and gitDir is the per-worktree directory it
+// names, while commonDir is the shared directory holding refs and packed-refs.
+type gitMeta struct {
+	gitDir    string
+	commonDir string
+}
+
+// resolveGitMeta locates the git directories for the working tree at dir.
+// It reads .git files and commondir pointers directly rather than spawning git.
+// Returns ok=false if dir has no usable .git entry.
+func resolveGitMeta(dir string) (gitMeta, bool) {
+	dotGit := filepath.Join(dir, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return gitMeta{}, false
+	}
+
+	gitDir := dotGit
+	if !info.IsDir() {
+		// Linked worktree or submodule: ".git" contains "gitdir: <path>".
+		data, err := os.ReadFile(dotGit)
+		if err != nil {
+			return gitMeta{}, false
+		}
+		line := strings.TrimSpace(string(data))
+		if !strings.HasPrefix(line, "gitdir:") {
+			return gitMeta{}, false
+		}
+		gitDir = strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(dir, gitDir)
+		}
+	}
+	gitDir = filepath.Clean(gitDir)
+
+	commonDir := gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+		commonDir = filepath.Clean(commonDir)
+	}
+	return gitMeta{gitDir: gitDir, commonDir: commonDir}, true
+}
+
+// refsHeadsDir returns the directory holding loose branch refs.
+func (g gitMeta) refsHeadsDir() string {
+	return filepath.Join(g.commonDir, "refs", "heads")
+}
+
+// addGitMeta watches the files whose changes alter what a diff shows:
+// HEAD and index in the per-worktree gitdir, packed-refs in the common dir,
+// and every directory under refs/heads. info/ is watched so edits to
+// info/exclude can invalidate cached ignore answers. The gitdirs themselves
+// are watched non-recursively so object writes under objects/ never reach us.
+func addGitMeta(w *fsnotify.Watcher, g gitMeta) {
+	dirs := []string{g.gitDir}
+	if g.commonDir != g.gitDir {
+		dirs = append(dirs, g.commonDir)
+	}
+	if info, err := os.Stat(filepath.Join(g.commonDir, "info")); err == nil && info.IsDir() {
+		dirs = append(dirs, filepath.Join(g.commonDir, "info"))
+	}
+	for _, d := range dirs {
+		if err := w.Add(d); err != nil {
+			log.Printf("watcher: debug: add %s: %v", d, err)
+		}
+	}
+	addRefsDir(w, g.refsHeadsDir())
+}
+
+// addRefsDir watches root and every subdirectory (branch names with "/").
+func addRefsDir(w *fsnotify.Watcher, root string) {
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if err := w.Add(path); err != nil {
+			log.Printf("watcher: debug: add %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// owns reports whether path lies inside one of the git metadata directories.
+func (g gitMeta) owns(path string) bool {
+	return isWithin(g.gitDir, path) || isWithin(g.commonDir, path)
+}
+
+// isRelevant reports whether a change to path inside the git metadata
+// should trigger a refresh. Lock files are ignored: git writes HEAD.lock,
+// index.lock etc. and renames them into place, and the rename itself
+// produces an event for the final name.
+func (g gitMeta) isRelevant(path string) bool {
+	if strings.HasSuffix(path, ".lock") {
+		return false
+	}
+	if isWithin(g.refsHeadsDir(), path) {
+		return true
+	}
+	switch filepath.Clean(path) {
+	case filepath.Join(g.gitDir, "HEAD"),
+		filepath.Join(g.gitDir, "index"),
+		filepath.Join(g.commonDir, "packed-refs"):
+		return true
+	}
+	return false
+}
+
+// isWithin reports whether path is dir or a descendant of it.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
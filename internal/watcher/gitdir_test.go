@@ -0,0 +1,72 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveGitMeta(t *testing.T) {
+	root := t.TempDir()
+	mkdir := func(rel string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(root, rel), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mainGit := filepath.Join(root, "main", ".git")
+	mkdir("main/.git/worktrees/feature")
+	writeFile(t, filepath.Join(mainGit, "worktrees", "feature", "commondir"), "../..\n")
+	writeFile(t, filepath.Join(mainGit, "modules", "lib", "HEAD"), "ref: refs/heads/main\n")
+
+	writeFile(t, filepath.Join(root, "feature", ".git"), "gitdir: "+filepath.Join(mainGit, "worktrees", "feature")+"\n")
+	writeFile(t, filepath.Join(root, "main", "lib", ".git"), "gitdir: ../.git/modules/lib\n")
+	writeFile(t, filepath.Join(root, "broken", ".git"), "not a pointer\n")
+	mkdir("plain")
+
+	tests := []struct {
+		name string
+		dir  string
+		want gitMeta
+		ok   bool
+	}{
+		{"repository", filepath.Join(root, "main"), gitMeta{gitDir: mainGit, commonDir: mainGit}, true},
+		{"linked worktree", filepath.Join(root, "feature"), gitMeta{gitDir: filepath.Join(mainGit, "worktrees", "feature"), commonDir: mainGit}, true},
+		{"submodule with relative gitdir", filepath.Join(root, "main", "lib"), gitMeta{gitDir: filepath.Join(mainGit, "modules", "lib"), commonDir: filepath.Join(mainGit, "modules", "lib")}, true},
+		{"gitfile without gitdir", filepath.Join(root, "broken"), gitMeta{}, false},
+		{"no .git", filepath.Join(root, "plain"), gitMeta{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := resolveGitMeta(tt.dir)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("resolveGitMeta(%s) = %+v, %v; want %+v, %v", tt.dir, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIsRelevant(t *testing.T) {
+	g := gitMeta{gitDir: "/repo/.git/worktrees/feature", commonDir: "/repo/.git"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/repo/.git/worktrees/feature/HEAD", true},
+		{"/repo/.git/worktrees/feature/index", true},
+		{"/repo/.git/worktrees/feature/index.lock", false},
+		{"/repo/.git/packed-refs", true},
+		{"/repo/.git/refs/heads/main", true},
+		{"/repo/.git/refs/heads/team/topic", true},
+		{"/repo/.git/refs/heads/main.lock", false},
+		{"/repo/.git/HEAD", false}, // the main worktree's HEAD, not this one's
+		{"/repo/.git/refs/tags/v1", false},
+		{"/repo/.git/objects/ab/cdef", false},
+		{"/repo/.git/worktrees/feature/ORIG_HEAD", false},
+	}
+	for _, tt := range tests {
+		if got := g.isRelevant(tt.path); got != tt.want {
+			t.Errorf("isRelevant(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
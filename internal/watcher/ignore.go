@@ -0,0 +1,186 @@
+package watcher
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ignoreChecker answers "is this path gitignored?" for one repository using a
+// single long-lived `git check-ignore --stdin` coprocess, so walking a large
+// tree costs one process spawn instead of one per directory.
+// Answers for directories walked by ignoredBatch are cached until invalidate
+// is called (a .gitignore or info/exclude changed); invalidation also
+// restarts the coprocess, since git caches the ignore files it has already
+// read. Answers for single event paths are not cached, so the cache stays
+// bounded by the tree's directories however many files change.
+type ignoreChecker struct {
+	mu     sync.Mutex
+	dir    string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	cache  map[string]bool
+}
+
+// newIgnoreChecker returns a checker for the repo at dir. The coprocess is
+// started lazily on the first uncached query.
+func newIgnoreChecker(dir string) *ignoreChecker {
+	return &ignoreChecker{dir: dir, cache: make(map[string]bool)}
+}
+
+// ignored reports whether path is ignored by git, without caching the answer.
+// Returns false on any error (e.g. git not found, path outside repo).
+func (c *ignoreChecker) ignored(path string) bool {
+	return c.check([]string{path}, false)[0]
+}
+
+// ignoredBatch reports, for each of paths (directories being walked), whether
+// it is ignored by git, caching the answers. Uncached paths are sent to the
+// coprocess in one round trip.
+func (c *ignoreChecker) ignoredBatch(paths []string) []bool {
+	return c.check(paths, true)
+}
+
+// check answers ignoredBatch and ignored, storing new answers if store is set.
+func (c *ignoreChecker) check(paths []string, store bool) []bool {
+	res := make([]bool, len(paths))
+	if c == nil || c.dir == "" {
+		return res
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var query []string
+	var queryIdx []int
+	for i, p := range paths {
+		if v, ok := c.cache[p]; ok {
+			res[i] = v
+			continue
+		}
+		// check-ignore dies on paths outside the work tree; don't ask.
+		if !isWithin(c.dir, p) {
+			continue
+		}
+		query = append(query, p)
+		queryIdx = append(queryIdx, i)
+	}
+	if len(query) == 0 {
+		return res
+	}
+
+	answers, err := c.query(query)
+	if err != nil {
+		// The coprocess is unusable (e.g. a path inside a submodule made git
+		// exit). Drop it so the next call starts a fresh one, and treat the
+		// unanswered paths as not ignored.
+		log.Printf("watcher: debug: check-ignore: %v", err)
+		c.stop()
+	}
+	for k, ign := range answers {
+		res[queryIdx[k]] = ign
+		if store {
+			c.cache[query[k]] = ign
+		}
+	}
+	return res
+}
+
+// query sends paths to the coprocess and reads one verbose record per path.
+// On error it returns the answers read so far.
+func (c *ignoreChecker) query(paths []string) ([]bool, error) {
+	if c.cmd == nil {
+		if err := c.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Write from a separate goroutine: git answers as it reads, so a large
+	// batch would otherwise fill both pipes and deadlock.
+	stdin := c.stdin
+	writeErr := make(chan error, 1)
+	go func() {
+		w := bufio.NewWriter(stdin)
+		for _, p := range paths {
+			if _, err := w.WriteString(p + "\x00"); err != nil {
+				writeErr <- err
+				return
+			}
+		}
+		writeErr <- w.Flush()
+	}()
+
+	answers := make([]bool, 0, len(paths))
+	for range paths {
+		// Record: <source> NUL <linenum> NUL <pattern> NUL <pathname> NUL.
+		// With --non-matching, unmatched paths have empty source and pattern.
+		var fields [4]string
+		for f := range fields {
+			s, err := c.stdout.ReadString(0)
+			if err != nil {
+				return answers, fmt.Errorf("read: %w", err)
+			}
+			fields[f] = strings.TrimSuffix(s, "\x00")
+		}
+		pattern := fields[2]
+		// A matching negated pattern ("!keep.me") means the path is re-included.
+		answers = append(answers, pattern != "" && !strings.HasPrefix(pattern, "!"))
+	}
+	if err := <-writeErr; err != nil {
+		return answers, fmt.Errorf("write: %w", err)
+	}
+	return answers, nil
+}
+
+func (c *ignoreChecker) start() error {
+	cmd := exec.Command("git", "-C", c.dir, "check-ignore", "--stdin", "-z", "--non-matching", "--verbose")
+	// Without GIT_FLUSH git buffers its answers when stdout is a pipe.
+	cmd.Env = append(os.Environ(), "GIT_FLUSH=1")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	c.cmd = cmd
+	c.stdin = stdin
+	c.stdout = bufio.NewReader(stdout)
+	return nil
+}
+
+// stop terminates the coprocess, if running. Callers must hold c.mu.
+func (c *ignoreChecker) stop() {
+	if c.cmd == nil {
+		return
+	}
+	c.stdin.Close()
+	_ = c.cmd.Process.Kill()
+	_ = c.cmd.Wait()
+	c.cmd, c.stdin, c.stdout = nil, nil, nil
+}
+
+// invalidate drops all cached answers and restarts the coprocess on next use.
+func (c *ignoreChecker) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache = make(map[string]bool)
+	c.stop()
+}
+
+// close releases the coprocess.
+func (c *ignoreChecker) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop()
+}
@@ -0,0 +1,153 @@
+package watcher
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// initRepo creates an empty git repository in a temp dir and returns its path.
+func initRepo(tb testing.TB) string {
+	tb.Helper()
+	dir := tb.TempDir()
+	if out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+		tb.Fatalf("git init: %s", out)
+	}
+	return dir
+}
+
+func writeFile(tb testing.TB, path, content string) {
+	tb.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestIgnoreChecker(t *testing.T) {
+	dir := initRepo(t)
+	writeFile(t, filepath.Join(dir, ".gitignore"), "out/\n*.log\n!keep.log\n")
+	for _, d := range []string{"out", "src"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newIgnoreChecker(dir)
+	defer c.close()
+
+	paths := []string{
+		filepath.Join(dir, "out"),
+		filepath.Join(dir, "src"),
+		filepath.Join(dir, "debug.log"),
+		filepath.Join(dir, "keep.log"),
+		"/elsewhere/entirely",
+	}
+	got := c.ignoredBatch(paths)
+	want := []bool{true, false, true, false, false}
+	for i := range paths {
+		if got[i] != want[i] {
+			t.Errorf("%s: ignored=%v, want %v", paths[i], got[i], want[i])
+		}
+	}
+
+	// Cached until invalidated, even though the rules changed on disk.
+	writeFile(t, filepath.Join(dir, ".gitignore"), "src/\n")
+	if c.ignored(filepath.Join(dir, "src")) {
+		t.Error("src: expected cached answer before invalidate")
+	}
+	c.invalidate()
+	if !c.ignored(filepath.Join(dir, "src")) {
+		t.Error("src: expected ignored after invalidate")
+	}
+	if c.ignored(filepath.Join(dir, "out")) {
+		t.Error("out: expected not ignored after invalidate")
+	}
+}
+
+func TestRescan(t *testing.T) {
+	dir := initRepo(t)
+	writeFile(t, filepath.Join(dir, ".gitignore"), "out/\n")
+	for _, d := range []string{"out/sub", "src"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	e := &watchEntry{dir: dir, w: w, ignore: newIgnoreChecker(dir)}
+	defer e.ignore.close()
+
+	watched := func() map[string]bool {
+		m := make(map[string]bool)
+		for _, p := range w.WatchList() {
+			m[p] = true
+		}
+		return m
+	}
+	addRecursive(w, dir, e.ignore)
+	if got := watched(); got[filepath.Join(dir, "out")] || !got[filepath.Join(dir, "src")] {
+		t.Fatalf("before: watching %v", w.WatchList())
+	}
+
+	writeFile(t, filepath.Join(dir, ".gitignore"), "src/\n")
+	e.ignore.invalidate()
+	e.rescan()
+	got := watched()
+	for _, d := range []string{"", "out", "out/sub"} {
+		if !got[filepath.Join(dir, d)] {
+			t.Errorf("%q: not watched after rescan", d)
+		}
+	}
+	if got[filepath.Join(dir, "src")] {
+		t.Error("src: still watched after it was ignored")
+	}
+}
+
+// BenchmarkAddRecursive measures subscribe-time directory walking on a repo
+// with 20,000 directories, a tenth of which are gitignored.
+func BenchmarkAddRecursive(b *testing.B) {
+	const top, perTop = 200, 100
+	dir := initRepo(b)
+	writeFile(b, filepath.Join(dir, ".gitignore"), "gen*/\n")
+	for i := 0; i < top; i++ {
+		parent := fmt.Sprintf("pkg%03d", i)
+		if i%10 == 0 {
+			parent = fmt.Sprintf("gen%03d", i)
+		}
+		for j := 0; j < perTop-1; j++ {
+			if err := os.MkdirAll(filepath.Join(dir, parent, fmt.Sprintf("d%02d", j)), 0o755); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	log.SetOutput(io.Discard) // inotify limits may reject some adds
+	defer log.SetOutput(os.Stderr)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			b.Fatal(err)
+		}
+		c := newIgnoreChecker(dir)
+		start := time.Now()
+		addRecursive(w, dir, c)
+		b.ReportMetric(float64(time.Since(start).Milliseconds()), "ms/subscribe")
+		c.close()
+		w.Close()
+	}
+}
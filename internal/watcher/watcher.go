@@ -1,13 +1,12 @@
 package watcher
 
 import (
-	"io/fs"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -42,11 +41,15 @@ type watchEntry struct {
 	mu        sync.Mutex
 	w         *fsnotify.Watcher
 	dir       string
+	git       gitMeta
+	hasGit    bool // false if dir has no resolvable .git (metadata is then not watched)
+	ignore    *ignoreChecker
 	debounce  time.Duration
 	subs      map[int]chan struct{}
 	nextID    int
 	stopTimer *time.Timer // fires after gracePeriod when no subscribers remain
 	closeOnce sync.Once
+	closed    atomic.Bool
 }
 
 // NewManager creates a new Manager.
@@ -66,11 +69,19 @@ func (m *Manager) Subscribe(dir string, debounce time.Duration) (<-chan struct{}
 			m.mu.Unlock()
 			return nil, nil, err
 		}
+		ignore := newIgnoreChecker(dir)
 		// Partial watch is acceptable; errors are logged inside addRecursive.
-		addRecursive(w, dir, dir)
+		addRecursive(w, dir, ignore)
+		meta, hasGit := resolveGitMeta(dir)
+		if hasGit {
+			addGitMeta(w, meta)
+		}
 		entry = &watchEntry{
 			w:        w,
 			dir:      dir,
+			git:      meta,
+			hasGit:   hasGit,
+			ignore:   ignore,
 			debounce: debounce,
 			subs:     make(map[int]chan struct{}),
 		}
@@ -124,13 +135,18 @@ func (m *Manager) removeEntry(dir string) {
 }
 
 func (e *watchEntry) close() {
-	e.closeOnce.Do(func() { e.w.Close() })
+	e.closeOnce.Do(func() {
+		e.closed.Store(true)
+		e.w.Close()
+		e.ignore.close()
+	})
 }
 
 func (e *watchEntry) run() {
 	var (
-		mu    sync.Mutex
-		timer *time.Timer
+		mu     sync.Mutex
+		timer  *time.Timer
+		rescan *time.Timer
 	)
 	for {
 		select {
@@ -138,20 +154,43 @@ func (e *watchEntry) run() {
 			if !ok {
 				return
 			}
-			if isGitPath(event.Name) {
-				continue
-			}
-			if gitIgnored(e.dir, event.Name) {
-				continue
+			if e.isIgnoreSource(event.Name) {
+				e.ignore.invalidate()
+				// Re-walk once the burst of events a save makes has passed.
+				mu.Lock()
+				if rescan != nil {
+					rescan.Stop()
+				}
+				rescan = time.AfterFunc(e.debounce, e.rescan)
+				mu.Unlock()
 			}
-			// If a new directory was created, start watching it too
-			// (unless it should be skipped — e.g. a freshly created node_modules).
-			if event.Has(fsnotify.Create) {
-				if target, err := filepath.EvalSymlinks(event.Name); err == nil {
-					if info, err := os.Stat(target); err == nil && info.IsDir() {
-						base := filepath.Base(target)
-						if !isGitPath(target) && !skipDirs[base] && !gitIgnored(e.dir, target) {
-							addRecursive(e.w, target, e.dir)
+			if e.hasGit && e.git.owns(event.Name) {
+				// Commits, checkouts, stages and branch updates.
+				if !e.git.isRelevant(event.Name) {
+					continue
+				}
+				// A new branch namespace (e.g. refs/heads/feature/) needs its own watch.
+				if event.Has(fsnotify.Create) && isWithin(e.git.refsHeadsDir(), event.Name) {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						addRefsDir(e.w, event.Name)
+					}
+				}
+			} else {
+				if isGitPath(event.Name) {
+					continue
+				}
+				if e.ignore.ignored(event.Name) {
+					continue
+				}
+				// If a new directory was created, start watching it too
+				// (unless it should be skipped — e.g. a freshly created node_modules).
+				if event.Has(fsnotify.Create) {
+					if target, err := filepath.EvalSymlinks(event.Name); err == nil {
+						if info, err := os.Stat(target); err == nil && info.IsDir() {
+							base := filepath.Base(target)
+							if !isGitPath(target) && !skipDirs[base] && !e.ignore.ignored(target) {
+								addRecursive(e.w, target, e.ignore)
+							}
 						}
 					}
 				}
@@ -181,36 +220,69 @@ func (e *watchEntry) run() {
 	}
 }
 
-// addRecursive adds root and all non-ignored subdirectories to the watcher.
-// repoDir is passed to git check-ignore so that git's ignore rules apply.
-// Failures on individual paths are logged and skipped rather than aborting the walk.
-func addRecursive(w *fsnotify.Watcher, root, repoDir string) {
-	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return nil // skip unreadable entries
+// rescan re-walks the tree after its ignore rules changed: directories they
+// now include are watched, and ones they now exclude are no longer.
+func (e *watchEntry) rescan() {
+	if e.closed.Load() {
+		return
+	}
+	walked := make(map[string]bool)
+	for _, dir := range addRecursive(e.w, e.dir, e.ignore) {
+		walked[dir] = true
+	}
+	for _, path := range e.w.WatchList() {
+		if walked[path] || !isWithin(e.dir, path) || isGitPath(path) || (e.hasGit && e.git.owns(path)) {
+			continue
 		}
-		if !d.IsDir() {
-			return nil
+		if err := e.w.Remove(path); err != nil {
+			log.Printf("watcher: debug: remove %s: %v", path, err)
 		}
-		if isGitPath(path) {
-			return filepath.SkipDir
+	}
+}
+
+// addRecursive adds root and all non-ignored subdirectories to the watcher
+// and returns the directories it walked.
+// The tree is walked breadth-first so that each directory's children can be
+// checked against git's ignore rules in a single batch.
+// Failures on individual paths are logged and skipped rather than aborting the walk.
+func addRecursive(w *fsnotify.Watcher, root string, ignore *ignoreChecker) []string {
+	if isGitPath(root) {
+		return nil
+	}
+	var walked []string
+	queue := []string{root}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		walked = append(walked, dir)
+		if err := w.Add(dir); err != nil {
+			log.Printf("watcher: debug: add %s: %v", dir, err)
 		}
-		if path != root {
-			base := filepath.Base(path)
-			// Skip well-known large dirs and all hidden dirs (e.g. .cache, .npm).
-			if skipDirs[base] || strings.HasPrefix(base, ".") {
-				return filepath.SkipDir
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue // skip unreadable directories
+		}
+		var children []string
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
 			}
-			// Skip git-ignored directories (e.g. vendor, dist, bin).
-			if gitIgnored(repoDir, path) {
-				return filepath.SkipDir
+			// Skip well-known large dirs and all hidden dirs (e.g. .git, .cache, .npm).
+			name := entry.Name()
+			if skipDirs[name] || strings.HasPrefix(name, ".") {
+				continue
 			}
+			children = append(children, filepath.Join(dir, name))
 		}
-		if err := w.Add(path); err != nil {
-			log.Printf("watcher: debug: add %s: %v", path, err)
+		// Skip git-ignored directories (e.g. vendor, dist, bin).
+		for i, ign := range ignore.ignoredBatch(children) {
+			if !ign {
+				queue = append(queue, children[i])
+			}
 		}
-		return nil
-	})
+	}
+	return walked
 }
 
 // isGitPath reports whether path contains a ".git" component.
@@ -224,12 +296,11 @@ func isGitPath(path string) bool {
 	return false
 }
 
-// gitIgnored reports whether path is ignored by git in the given repo directory.
-// Returns false on any error (e.g. git not found, path outside repo).
-func gitIgnored(repoDir, path string) bool {
-	if repoDir == "" {
-		return false
+// isIgnoreSource reports whether path is a file that can change git's ignore
+// rules for this tree: any .gitignore, or the repository's info/exclude.
+func (e *watchEntry) isIgnoreSource(path string) bool {
+	if filepath.Base(path) == ".gitignore" {
+		return true
 	}
-	cmd := exec.Command("git", "-C", repoDir, "check-ignore", "-q", "--", path)
-	return cmd.Run() == nil // exit 0 = ignored, 1 = not ignored, 128 = error
+	return e.hasGit && filepath.Clean(path) == filepath.Join(e.git.commonDir, "info", "exclude")
 }